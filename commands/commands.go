@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/kandlagifari/go-books-apps/database"
+	"github.com/kandlagifari/go-books-apps/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Run executes a one-off maintenance command such as
+//
+//	./bootstrap create-admin -username alice -password s3cret
+func Run(args []string) error {
+	switch args[0] {
+	case "create-admin":
+		return createAdmin(args[1:])
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// createAdmin promotes an existing user to admin, or creates the user when a
+// password is supplied and the username is free.
+func createAdmin(args []string) error {
+	flags := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	username := flags.String("username", "", "username to create or promote")
+	password := flags.String("password", "", "password for a new user")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" {
+		return fmt.Errorf("-username is required")
+	}
+
+	result, err := database.DbConnection.Exec("UPDATE users SET role=$1, modified_by=$2 WHERE username=$3", models.RoleAdmin, "system", *username)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
+		fmt.Println("Promoted", *username, "to admin")
+		return nil
+	}
+
+	if *password == "" {
+		return fmt.Errorf("user %q does not exist; pass -password to create it", *username)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.DbConnection.Exec("INSERT INTO users (username, password, role, created_at, created_by) VALUES ($1, $2, $3, NOW(), $4)",
+		*username, string(hashedPassword), models.RoleAdmin, "system")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Created admin", *username)
+	return nil
+}
@@ -0,0 +1,244 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kandlagifari/go-books-apps/idempotency"
+	"github.com/kandlagifari/go-books-apps/metadata"
+	"github.com/kandlagifari/go-books-apps/rules"
+)
+
+// DefaultFile is read when neither -config nor CONFIG_FILE names a file. It
+// is optional.
+const DefaultFile = "config/.env"
+
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// Config is the application configuration. Every setting can come from the
+// config file (by its yaml key), from the environment variable in its env tag
+// and from the flag of the same name in lower case with dashes, for example
+// DB_SSLMODE and -db-sslmode. Flags win over the environment, which wins over
+// the file. Settings tagged secret are redacted by -print-config.
+type Config struct {
+	Server      Server      `yaml:"server"`
+	Database    Database    `yaml:"database"`
+	Auth        Auth        `yaml:"auth"`
+	Mail        Mail        `yaml:"mail"`
+	Storage     Storage     `yaml:"storage"`
+	Metadata    Metadata    `yaml:"metadata"`
+	Idempotency Idempotency `yaml:"idempotency"`
+	Rules       Rules       `yaml:"rules"`
+	I18n        I18n        `yaml:"i18n"`
+
+	// PrintConfig is set by -print-config and Args holds the command line
+	// left after the flags, such as a maintenance command.
+	PrintConfig bool     `yaml:"-"`
+	Args        []string `yaml:"-"`
+}
+
+type Server struct {
+	Addr           string `yaml:"addr" env:"HTTP_ADDR" usage:"address the HTTP server listens on"`
+	BaseURL        string `yaml:"base_url" env:"APP_BASE_URL" usage:"public URL of this API, used in cover links and emails"`
+	FrontendURL    string `yaml:"frontend_url" env:"APP_FRONTEND_URL" usage:"web app that opens the verify-email and reset-password links sent by email"`
+	RequireIfMatch bool   `yaml:"require_if_match" env:"REQUIRE_IF_MATCH" usage:"reject writes to books and categories without If-Match"`
+
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"HTTP_READ_TIMEOUT" usage:"time to read a whole request, body included"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT" usage:"time to handle a request and write the response"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT" usage:"how long an idle keep-alive connection is kept"`
+	StreamTimeout     time.Duration `yaml:"stream_timeout" env:"HTTP_STREAM_TIMEOUT" usage:"read and write timeout of book imports and exports, 0 for none"`
+	// ShutdownDelay keeps serving with readiness failing before the listener
+	// is closed, giving load balancers time to take the instance out.
+	ShutdownDelay   time.Duration `yaml:"shutdown_delay" env:"HTTP_SHUTDOWN_DELAY" usage:"time to keep serving after readiness starts failing"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"HTTP_SHUTDOWN_TIMEOUT" usage:"time in-flight requests get to finish on shutdown"`
+}
+
+type Database struct {
+	Host            string        `yaml:"host" env:"DB_HOST"`
+	Port            int           `yaml:"port" env:"DB_PORT"`
+	User            string        `yaml:"user" env:"DB_USER"`
+	Password        string        `yaml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name            string        `yaml:"name" env:"DB_NAME"`
+	SSLMode         string        `yaml:"sslmode" env:"DB_SSLMODE" usage:"disable, allow, prefer, require, verify-ca or verify-full"`
+	SSLRootCert     string        `yaml:"sslrootcert" env:"DB_SSLROOTCERT" usage:"CA certificate for verify-ca and verify-full"`
+	SSLCert         string        `yaml:"sslcert" env:"DB_SSLCERT" usage:"client certificate"`
+	SSLKey          string        `yaml:"sslkey" env:"DB_SSLKEY" usage:"client certificate key"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS" usage:"maximum open connections, 0 for no limit"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" usage:"close connections after this long, 0 to keep them"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+}
+
+type Auth struct {
+	JWTSecret       string        `yaml:"jwt_secret" env:"JWT_SECRET_KEY" secret:"true" usage:"key that signs access tokens and cursors"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" env:"ACCESS_TOKEN_TTL"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL"`
+}
+
+type Mail struct {
+	Driver       string `yaml:"driver" env:"MAIL_DRIVER" usage:"outbox or smtp"`
+	From         string `yaml:"from" env:"MAIL_FROM"`
+	OutboxDir    string `yaml:"outbox_dir" env:"MAIL_OUTBOX_DIR"`
+	SMTPHost     string `yaml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     string `yaml:"smtp_port" env:"SMTP_PORT"`
+	SMTPUsername string `yaml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" env:"SMTP_PASSWORD" secret:"true"`
+}
+
+type Storage struct {
+	Driver string `yaml:"driver" env:"STORAGE_DRIVER"`
+	Dir    string `yaml:"dir" env:"STORAGE_DIR"`
+}
+
+type Metadata struct {
+	Providers      string        `yaml:"providers" env:"METADATA_PROVIDERS" usage:"comma separated, highest priority first"`
+	OpenLibraryURL string        `yaml:"openlibrary_url" env:"OPENLIBRARY_URL"`
+	FixturePath    string        `yaml:"fixture_path" env:"METADATA_FIXTURE_PATH"`
+	CacheTTL       time.Duration `yaml:"cache_ttl" env:"METADATA_CACHE_TTL"`
+	CacheSize      int           `yaml:"cache_size" env:"METADATA_CACHE_SIZE" usage:"most ISBN lookups kept in memory"`
+}
+
+type Idempotency struct {
+	Store       string        `yaml:"store" env:"IDEMPOTENCY_STORE" usage:"postgres or memory"`
+	TTL         time.Duration `yaml:"ttl" env:"IDEMPOTENCY_TTL"`
+	MaxBodySize int           `yaml:"max_body_size" env:"IDEMPOTENCY_MAX_BODY_SIZE" usage:"largest request body, in bytes, accepted with an Idempotency-Key"`
+}
+
+type Rules struct {
+	MinReleaseYear    int    `yaml:"release_year_min" env:"RELEASE_YEAR_MIN"`
+	MaxReleaseYear    int    `yaml:"release_year_max" env:"RELEASE_YEAR_MAX" usage:"fixed latest release year, 0 to follow the calendar"`
+	ReleaseYearsAhead int    `yaml:"release_years_ahead" env:"RELEASE_YEARS_AHEAD"`
+	ThicknessBuckets  string `yaml:"thickness_buckets" env:"THICKNESS_BUCKETS"`
+}
+
+type I18n struct {
+	Dir string `yaml:"dir" env:"I18N_DIR" usage:"directory with extra message catalogs"`
+}
+
+// Defaults returns the configuration used for settings nobody sets.
+func Defaults() *Config {
+	return &Config{
+		Server: Server{
+			Addr:              ":4321",
+			BaseURL:           "http://localhost:4321",
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       time.Minute,
+			WriteTimeout:      2 * time.Minute,
+			IdleTimeout:       2 * time.Minute,
+			StreamTimeout:     30 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Database: Database{
+			Host:            "localhost",
+			Port:            5432,
+			SSLMode:         "disable",
+			MaxOpenConns:    20,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+		},
+		Auth: Auth{
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+		},
+		Mail: Mail{
+			Driver:    "outbox",
+			OutboxDir: "outbox",
+		},
+		Storage: Storage{
+			Driver: "local",
+			Dir:    "uploads",
+		},
+		Metadata: Metadata{
+			Providers: "openlibrary",
+			CacheTTL:  time.Hour,
+			CacheSize: metadata.DefaultCacheSize,
+		},
+		Idempotency: Idempotency{
+			Store:       "postgres",
+			TTL:         idempotency.DefaultTTL,
+			MaxBodySize: 64 << 20,
+		},
+		Rules: Rules{
+			MinReleaseYear:    rules.DefaultMinReleaseYear,
+			ReleaseYearsAhead: rules.DefaultReleaseYearsAhead,
+			ThicknessBuckets:  rules.DefaultThicknessBuckets,
+		},
+	}
+}
+
+// Validate reports every setting the application cannot start with.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	_, _, err := net.SplitHostPort(c.Server.Addr)
+	check(err == nil, "HTTP_ADDR %q must be host:port, for example :4321", c.Server.Addr)
+	check(c.Server.ReadHeaderTimeout >= 0, "HTTP_READ_HEADER_TIMEOUT must not be negative")
+	check(c.Server.ReadTimeout >= 0, "HTTP_READ_TIMEOUT must not be negative")
+	check(c.Server.WriteTimeout >= 0, "HTTP_WRITE_TIMEOUT must not be negative")
+	check(c.Server.IdleTimeout >= 0, "HTTP_IDLE_TIMEOUT must not be negative")
+	check(c.Server.StreamTimeout >= 0, "HTTP_STREAM_TIMEOUT must not be negative")
+	check(c.Server.ShutdownDelay >= 0, "HTTP_SHUTDOWN_DELAY must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "HTTP_SHUTDOWN_TIMEOUT must be positive")
+
+	db := c.Database
+	check(db.Host != "", "DB_HOST is required")
+	check(db.Port > 0 && db.Port < 65536, "DB_PORT %d is not a valid port", db.Port)
+	check(db.User != "", "DB_USER is required")
+	check(db.Name != "", "DB_NAME is required")
+	check(slices.Contains(sslModes, db.SSLMode), "DB_SSLMODE must be one of: %s", strings.Join(sslModes, ", "))
+	check(db.SSLRootCert != "" || !strings.HasPrefix(db.SSLMode, "verify-"), "DB_SSLROOTCERT is required with DB_SSLMODE=%s", db.SSLMode)
+	check((db.SSLCert == "") == (db.SSLKey == ""), "DB_SSLCERT and DB_SSLKEY must be set together")
+	check(db.MaxOpenConns >= 0, "DB_MAX_OPEN_CONNS must not be negative")
+	check(db.MaxIdleConns >= 0, "DB_MAX_IDLE_CONNS must not be negative")
+	check(db.MaxOpenConns == 0 || db.MaxIdleConns <= db.MaxOpenConns, "DB_MAX_IDLE_CONNS must not exceed DB_MAX_OPEN_CONNS")
+	check(db.ConnMaxLifetime >= 0, "DB_CONN_MAX_LIFETIME must not be negative")
+	check(db.ConnMaxIdleTime >= 0, "DB_CONN_MAX_IDLE_TIME must not be negative")
+
+	check(strings.TrimSpace(c.Auth.JWTSecret) != "", "JWT_SECRET_KEY is required")
+	check(c.Auth.AccessTokenTTL > 0, "ACCESS_TOKEN_TTL must be positive")
+	check(c.Auth.RefreshTokenTTL > c.Auth.AccessTokenTTL, "REFRESH_TOKEN_TTL must be longer than ACCESS_TOKEN_TTL")
+
+	check(c.Metadata.CacheTTL >= 0, "METADATA_CACHE_TTL must not be negative")
+	check(c.Metadata.CacheSize > 0, "METADATA_CACHE_SIZE must be positive")
+	check(c.Idempotency.TTL >= 0, "IDEMPOTENCY_TTL must not be negative")
+	check(c.Idempotency.MaxBodySize > 0, "IDEMPOTENCY_MAX_BODY_SIZE must be positive")
+
+	return errors.Join(errs...)
+}
+
+// DSN is the lib/pq connection string for the database settings.
+func (d Database) DSN() string {
+	params := []struct{ key, value string }{
+		{"host", d.Host},
+		{"port", fmt.Sprint(d.Port)},
+		{"user", d.User},
+		{"password", d.Password},
+		{"dbname", d.Name},
+		{"sslmode", d.SSLMode},
+		{"sslrootcert", d.SSLRootCert},
+		{"sslcert", d.SSLCert},
+		{"sslkey", d.SSLKey},
+	}
+
+	var dsn []string
+	for _, param := range params {
+		if param.value == "" {
+			continue
+		}
+		// Values are quoted so that spaces and quotes in passwords survive.
+		value := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(param.value)
+		dsn = append(dsn, fmt.Sprintf("%s='%s'", param.key, value))
+	}
+	return strings.Join(dsn, " ")
+}
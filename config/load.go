@@ -0,0 +1,200 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "REDACTED"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setting is one configurable field of Config.
+type setting struct {
+	env    string
+	usage  string
+	secret bool
+	value  reflect.Value
+}
+
+func (s setting) flagName() string {
+	return strings.ReplaceAll(strings.ToLower(s.env), "_", "-")
+}
+
+func (s setting) set(raw string) error {
+	raw = strings.TrimSpace(raw)
+
+	switch {
+	case s.value.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a duration such as 30s or 1h", s.env, raw)
+		}
+		s.value.SetInt(int64(d))
+	case s.value.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not an integer", s.env, raw)
+		}
+		s.value.SetInt(int64(n))
+	case s.value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not true or false", s.env, raw)
+		}
+		s.value.SetBool(b)
+	default:
+		s.value.SetString(raw)
+	}
+	return nil
+}
+
+// settings lists the fields of v, a pointer to a struct, that have an env tag.
+func settings(v any) []setting {
+	var out []setting
+	var walk func(reflect.Value)
+	walk = func(value reflect.Value) {
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+				walk(value.Field(i))
+				continue
+			}
+			if env := field.Tag.Get("env"); env != "" {
+				out = append(out, setting{
+					env:    env,
+					usage:  field.Tag.Get("usage"),
+					secret: field.Tag.Get("secret") == "true",
+					value:  value.Field(i),
+				})
+			}
+		}
+	}
+	walk(reflect.ValueOf(v).Elem())
+	return out
+}
+
+// Load builds the configuration from the defaults, the config file, the
+// environment and the command line flags in args, in increasing priority, and
+// validates it. Arguments after the flags are left in Args. With
+// -print-config an invalid configuration is returned along with the error so
+// it can be inspected.
+func Load(args []string) (*Config, error) {
+	cfg := Defaults()
+	all := settings(cfg)
+
+	flags := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	file := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML or .env config file (default "+DefaultFile+" when it exists)")
+	flags.BoolVar(&cfg.PrintConfig, "print-config", false, "print the configuration with secrets redacted and exit")
+
+	// Flag values are kept aside until the file and environment are applied.
+	var fromFlags []func() error
+	for _, s := range all {
+		usage := s.usage
+		if usage == "" {
+			usage = "sets " + s.env
+		}
+		record := func(raw string) error {
+			fromFlags = append(fromFlags, func() error { return s.set(raw) })
+			return nil
+		}
+		if s.value.Kind() == reflect.Bool {
+			flags.BoolFunc(s.flagName(), usage, func(raw string) error { return record(raw) })
+		} else {
+			flags.Func(s.flagName(), usage, record)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	cfg.Args = flags.Args()
+
+	path, required := *file, true
+	if path == "" {
+		path, required = DefaultFile, false
+	}
+	fileEnv, err := readFile(cfg, path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range all {
+		raw, ok := os.LookupEnv(s.env)
+		if !ok {
+			raw, ok = fileEnv[s.env]
+		}
+		if ok {
+			if err := s.set(raw); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, apply := range fromFlags {
+		if err := apply(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		if cfg.PrintConfig {
+			return cfg, err
+		}
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, nil
+}
+
+// readFile loads a YAML file into cfg, or returns the variables of a .env
+// file so they can be applied below the real environment.
+func readFile(cfg *Config, path string) (map[string]string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		decoder := yaml.NewDecoder(f)
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return nil, nil
+	default:
+		return godotenv.Read(path)
+	}
+}
+
+// Print writes the configuration as YAML, which can be used as a config file,
+// with secrets replaced.
+func (c *Config) Print(w io.Writer) error {
+	copied := *c
+	for _, s := range settings(&copied) {
+		if s.secret && s.value.String() != "" {
+			s.value.SetString(redacted)
+		}
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&copied); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,319 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/database"
+	"github.com/kandlagifari/go-books-apps/i18n"
+	"github.com/kandlagifari/go-books-apps/mailer"
+	"github.com/kandlagifari/go-books-apps/models"
+	"github.com/kandlagifari/go-books-apps/problem"
+	"github.com/kandlagifari/go-books-apps/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	tokenPurposeVerifyEmail   = "verify_email"
+	tokenPurposeResetPassword = "reset_password"
+
+	verifyEmailTTL   = 24 * time.Hour
+	resetPasswordTTL = time.Hour
+)
+
+var AppBaseURL = "http://localhost:4321"
+
+// FrontendURL is the web app that opens the links sent by email, which get
+// the token in the query string. Without one, the emails tell the user which
+// API endpoint to send the token to instead.
+var FrontendURL = ""
+
+// tokenInstructions tells the reader of an email how to use token: a link to
+// page of the frontend, or the API request to make, with body as its JSON.
+func tokenInstructions(page, endpoint, token string, body string) string {
+	if FrontendURL != "" {
+		return fmt.Sprintf("%s/%s?token=%s", strings.TrimRight(FrontendURL, "/"), page, url.QueryEscape(token))
+	}
+	return fmt.Sprintf("POST %s%s\n%s", strings.TrimRight(AppBaseURL, "/"), endpoint, fmt.Sprintf(body, token))
+}
+
+// issueUserToken stores a single-use token for the given purpose. Any earlier
+// unused token for the same purpose is invalidated so only the latest email
+// link works.
+func issueUserToken(db dbExecutor, userID int, purpose string, ttl time.Duration) (string, error) {
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.Exec("UPDATE user_tokens SET used_at=NOW() WHERE user_id=$1 AND purpose=$2 AND used_at IS NULL", userID, purpose)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.Exec("INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at) VALUES ($1, $2, $3, $4)",
+		userID, purpose, utils.HashToken(token), time.Now().Add(ttl))
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// consumeUserToken marks a token as used and returns its owner. Expired, used
+// and unknown tokens all yield sql.ErrNoRows.
+func consumeUserToken(db dbExecutor, token, purpose string) (int, error) {
+	var userID int
+	query := `
+		UPDATE user_tokens SET used_at=NOW()
+		WHERE token_hash=$1 AND purpose=$2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`
+	err := db.QueryRow(query, utils.HashToken(token), purpose).Scan(&userID)
+	return userID, err
+}
+
+func verificationEmail(email, token string) mailer.Message {
+	return mailer.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Confirm your email address with:\n\n%s\n\nThis expires in %s.\n",
+			tokenInstructions("verify-email", "/api/users/verify-email", token, `{"token": %q}`), verifyEmailTTL),
+	}
+}
+
+func VerifyEmail(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	tx, err := database.DbConnection.Begin()
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer tx.Rollback()
+
+	userID, err := consumeUserToken(tx, input.Token, tokenPurposeVerifyEmail)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			problem.RespondCode(c, http.StatusBadRequest, "token_invalid", "Invalid or expired token")
+			return
+		}
+		problem.Respond(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	before, err := userSnapshot(tx, userID, true)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Unable to verify email")
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE users SET email_verified_at=NOW() WHERE id=$1", userID); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Unable to verify email")
+		return
+	}
+
+	if err := recordUserAudit(tx, before["username"], models.AuditActionUpdate, userID, before); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to record audit log")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Unable to verify email")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": i18n.T(c, "Email verified successfully")})
+}
+
+func ForgotPassword(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	// The lookup and the email happen after the response is sent, so neither
+	// the response nor its timing tells whether the address has an account.
+	if !queuePasswordReset(input.Email) {
+		log.Println("password reset queue is full, dropping a request")
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": i18n.T(c, "If the email is registered, a password reset link has been sent")})
+}
+
+const (
+	passwordResetWorkers   = 4
+	passwordResetQueueSize = 256
+)
+
+// Password resets are handled by a fixed set of workers reading a bounded
+// queue, so a flood of requests cannot start unbounded work. Requests that
+// find the queue full are dropped; the response is the same either way.
+var (
+	passwordResets       = make(chan string, passwordResetQueueSize)
+	passwordResetsMu     sync.RWMutex
+	passwordResetsClosed bool
+	passwordResetWorker  sync.WaitGroup
+)
+
+func queuePasswordReset(address string) bool {
+	passwordResetsMu.RLock()
+	defer passwordResetsMu.RUnlock()
+
+	if passwordResetsClosed {
+		return false
+	}
+	select {
+	case passwordResets <- address:
+		return true
+	default:
+		return false
+	}
+}
+
+// StartPasswordResets starts the workers that send queued reset emails.
+func StartPasswordResets() {
+	for i := 0; i < passwordResetWorkers; i++ {
+		passwordResetWorker.Add(1)
+		go func() {
+			defer passwordResetWorker.Done()
+			for address := range passwordResets {
+				sendPasswordReset(address)
+			}
+		}()
+	}
+}
+
+// StopPasswordResets stops taking requests and waits until the queued ones
+// are sent or ctx is done. It must run before the database is closed.
+func StopPasswordResets(ctx context.Context) error {
+	passwordResetsMu.Lock()
+	if !passwordResetsClosed {
+		passwordResetsClosed = true
+		close(passwordResets)
+	}
+	passwordResetsMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		passwordResetWorker.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sendPasswordReset mails a reset link to the account with the given address,
+// if there is one. It runs on a worker, so failures are only logged.
+func sendPasswordReset(address string) {
+	var userID int
+	var email string
+	err := database.DbConnection.QueryRow("SELECT id, email FROM users WHERE LOWER(email) = LOWER($1)", address).Scan(&userID, &email)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Println("forgot password lookup failed:", err)
+		}
+		return
+	}
+
+	token, err := issueUserToken(database.DbConnection, userID, tokenPurposeResetPassword, resetPasswordTTL)
+	if err != nil {
+		log.Println("issuing password reset token failed:", err)
+		return
+	}
+
+	err = mailer.Default.Send(mailer.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("A password reset was requested for your account. Choose a new password with:\n\n%s\n\nThis expires in %s. If you did not ask for this, ignore this email.\n",
+			tokenInstructions("reset-password", "/api/users/reset-password", token, `{"token": %q, "password": "<new password>"}`), resetPasswordTTL),
+	})
+	if err != nil {
+		log.Println("sending password reset email failed:", err)
+	}
+}
+
+func ResetPassword(c *gin.Context) {
+	var input struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,min=8,max=72"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Unable to hash password")
+		return
+	}
+
+	tx, err := database.DbConnection.Begin()
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer tx.Rollback()
+
+	userID, err := consumeUserToken(tx, input.Token, tokenPurposeResetPassword)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			problem.RespondCode(c, http.StatusBadRequest, "token_invalid", "Invalid or expired token")
+			return
+		}
+		problem.Respond(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	before, err := userSnapshot(tx, userID, true)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Unable to reset password")
+		return
+	}
+
+	// Receiving the reset link proves ownership of the address as well.
+	query := "UPDATE users SET password=$1, email_verified_at=COALESCE(email_verified_at, NOW()), modified_by=$2 WHERE id=$3"
+	if _, err := tx.Exec(query, string(hashedPassword), "system", userID); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Unable to reset password")
+		return
+	}
+
+	if err := recordUserAudit(tx, before["username"], models.AuditActionPasswordReset, userID, before); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to record audit log")
+		return
+	}
+
+	if err := revokeUserTokens(tx, userID); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Unable to reset password")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Unable to reset password")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": i18n.T(c, "Password reset successfully")})
+}
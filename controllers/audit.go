@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/database"
+	"github.com/kandlagifari/go-books-apps/models"
+	"github.com/kandlagifari/go-books-apps/problem"
+	"github.com/kandlagifari/go-books-apps/utils"
+)
+
+// auditIgnoredFields are bookkeeping columns that change on every write; the
+// audit entry already records who made the change and when.
+var auditIgnoredFields = map[string]bool{
+	"modified_at": true,
+	"modified_by": true,
+	"version":     true,
+}
+
+type fieldChange struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+func snapshot(value any) (map[string]any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if v := reflect.ValueOf(value); (v.Kind() == reflect.Pointer || v.Kind() == reflect.Map) && v.IsNil() {
+		return nil, nil
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// diffSnapshots returns the fields whose JSON representation differs between
+// before and after. A nil side means the entity did not exist on that side.
+func diffSnapshots(before, after map[string]any) map[string]fieldChange {
+	changes := map[string]fieldChange{}
+	for key, oldValue := range before {
+		if auditIgnoredFields[key] {
+			continue
+		}
+		newValue, ok := after[key]
+		if !ok || !reflect.DeepEqual(oldValue, newValue) {
+			changes[key] = fieldChange{Old: oldValue, New: newValue}
+		}
+	}
+	for key, newValue := range after {
+		if auditIgnoredFields[key] {
+			continue
+		}
+		if _, ok := before[key]; !ok {
+			changes[key] = fieldChange{Old: nil, New: newValue}
+		}
+	}
+	return changes
+}
+
+// recordAudit must be called with the same transaction as the mutation it
+// describes so the log can never disagree with the data.
+func recordAudit(db dbExecutor, actor any, action, entity string, entityID int, before, after any) error {
+	oldFields, err := snapshot(before)
+	if err != nil {
+		return err
+	}
+	newFields, err := snapshot(after)
+	if err != nil {
+		return err
+	}
+
+	changes, err := json.Marshal(diffSnapshots(oldFields, newFields))
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("INSERT INTO audit_log (actor, action, entity, entity_id, changes) VALUES ($1, $2, $3, $4, $5)",
+		actor, action, entity, entityID, string(changes))
+	return err
+}
+
+func parseTimeParam(c *gin.Context, name string) (*time.Time, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if parsed, err := time.Parse(layout, raw); err == nil {
+			return &parsed, nil
+		}
+	}
+	return nil, problem.NewFieldError(name, "format", "%s must be an RFC 3339 timestamp or a YYYY-MM-DD date", name)
+}
+
+func listAuditLog(c *gin.Context, q *queryBuilder) {
+	pagination, err := utils.ParsePagination(c.Request.URL.Query())
+	if err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	var total int
+	if err := database.DbConnection.QueryRow("SELECT COUNT(*) FROM audit_log"+q.whereClause(), q.args...).Scan(&total); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to fetch audit log")
+		return
+	}
+
+	query := "SELECT id, actor, action, entity, entity_id, changes, created_at FROM audit_log" + q.whereClause() +
+		" ORDER BY created_at DESC, id DESC LIMIT " + q.arg(pagination.Limit()) + " OFFSET " + q.arg(pagination.Offset())
+	rows, err := database.DbConnection.Query(query, q.args...)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to fetch audit log")
+		return
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var entry models.AuditEntry
+		var changes []byte
+		if err := rows.Scan(&entry.ID, &entry.Actor, &entry.Action, &entry.Entity, &entry.EntityID, &changes, &entry.CreatedAt); err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "Failed to parse audit entry")
+			return
+		}
+		entry.Changes = changes
+		entries = append(entries, entry)
+	}
+
+	pagination.SetTotal(total, c.Request.URL)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       entries,
+		"pagination": pagination,
+	})
+}
+
+func GetAuditLog(c *gin.Context) {
+	q := &queryBuilder{}
+
+	for _, param := range []string{"entity", "actor", "action"} {
+		if value := c.Query(param); value != "" {
+			q.where(param+" = %s", value)
+		}
+	}
+
+	entityID, ok, err := parseIntParam(c, "entity_id")
+	if err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
+		return
+	}
+	if ok {
+		q.where("entity_id = %s", entityID)
+	}
+
+	from, err := parseTimeParam(c, "from")
+	if err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
+		return
+	}
+	if from != nil {
+		q.where("created_at >= %s", *from)
+	}
+
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
+		return
+	}
+	if to != nil {
+		q.where("created_at < %s", *to)
+	}
+
+	listAuditLog(c, q)
+}
+
+func GetBookHistory(c *gin.Context) {
+	bookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid book id")
+		return
+	}
+
+	q := &queryBuilder{}
+	q.where("entity = %s", "book")
+	q.where("entity_id = %s", bookID)
+	listAuditLog(c, q)
+}
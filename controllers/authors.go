@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/database"
+	"github.com/kandlagifari/go-books-apps/i18n"
+	"github.com/kandlagifari/go-books-apps/models"
+	"github.com/kandlagifari/go-books-apps/problem"
+	"github.com/kandlagifari/go-books-apps/utils"
+	"github.com/lib/pq"
+)
+
+const authorColumns = "id, name, bio, created_at, created_by, modified_at, modified_by"
+
+func scanAuthor(row rowScanner, author *models.Author) error {
+	return row.Scan(&author.ID, &author.Name, &author.Bio, &author.CreatedAt, &author.CreatedBy, &author.ModifiedAt, &author.ModifiedBy)
+}
+
+func fetchAuthor(db dbExecutor, id any, forUpdate bool) (*models.Author, error) {
+	query := "SELECT " + authorColumns + " FROM authors WHERE id=$1"
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+
+	var author models.Author
+	if err := scanAuthor(db.QueryRow(query, id), &author); err != nil {
+		return nil, err
+	}
+	return &author, nil
+}
+
+func recordAuthorAudit(db dbExecutor, actor any, action string, id int, before *models.Author) error {
+	after, err := fetchAuthor(db, id, false)
+	if err != nil {
+		return err
+	}
+	return recordAudit(db, actor, action, "author", id, before, after)
+}
+
+func GetAuthors(c *gin.Context) {
+	q := &queryBuilder{}
+	if name := c.Query("name"); name != "" {
+		q.where("name ILIKE %s", "%"+name+"%")
+	}
+
+	pagination, err := utils.ParsePagination(c.Request.URL.Query())
+	if err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	var total int
+	if err := database.DbConnection.QueryRow("SELECT COUNT(*) FROM authors"+q.whereClause(), q.args...).Scan(&total); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to fetch authors")
+		return
+	}
+
+	query := "SELECT " + authorColumns + " FROM authors" + q.whereClause() +
+		" ORDER BY name, id LIMIT " + q.arg(pagination.Limit()) + " OFFSET " + q.arg(pagination.Offset())
+	rows, err := database.DbConnection.Query(query, q.args...)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to fetch authors")
+		return
+	}
+	defer rows.Close()
+
+	authors := []models.Author{}
+	for rows.Next() {
+		var author models.Author
+		if err := scanAuthor(rows, &author); err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "Failed to parse author")
+			return
+		}
+		authors = append(authors, author)
+	}
+
+	pagination.SetTotal(total, c.Request.URL)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       authors,
+		"pagination": pagination,
+	})
+}
+
+func CreateAuthor(c *gin.Context) {
+	var author models.Author
+	if err := c.ShouldBindJSON(&author); err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	createdBy, _ := c.Get("user")
+
+	tx, err := database.DbConnection.Begin()
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to create author")
+		return
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO authors (name, bio, created_by, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+	err = tx.QueryRow(query, author.Name, author.Bio, createdBy, time.Now()).Scan(&author.ID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to create author")
+		return
+	}
+
+	if err := recordAuthorAudit(tx, createdBy, models.AuditActionCreate, author.ID, nil); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to record audit log")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to create author")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   i18n.T(c, "Author created successfully"),
+		"author_id": author.ID,
+	})
+}
+
+func GetAuthorByID(c *gin.Context) {
+	id := c.Param("id")
+
+	author, err := fetchAuthor(database.DbConnection, id, false)
+	if err != nil {
+		problem.Respond(c, http.StatusNotFound, "Author not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, author)
+}
+
+func UpdateAuthor(c *gin.Context) {
+	id := c.Param("id")
+	var author models.Author
+
+	if err := c.ShouldBindJSON(&author); err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	updatedBy, _ := c.Get("user")
+
+	tx, err := database.DbConnection.Begin()
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to update author")
+		return
+	}
+	defer tx.Rollback()
+
+	existingAuthor, err := fetchAuthor(tx, id, true)
+	if err != nil {
+		problem.Respond(c, http.StatusNotFound, "Author not found")
+		return
+	}
+
+	query := `UPDATE authors SET name=$1, bio=$2, modified_at=$3, modified_by=$4 WHERE id=$5`
+	if _, err := tx.Exec(query, author.Name, author.Bio, time.Now(), updatedBy, existingAuthor.ID); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to update author")
+		return
+	}
+
+	if err := recordAuthorAudit(tx, updatedBy, models.AuditActionUpdate, existingAuthor.ID, existingAuthor); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to record audit log")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to update author")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": i18n.T(c, "Author updated successfully")})
+}
+
+func DeleteAuthor(c *gin.Context) {
+	id := c.Param("id")
+	deletedBy, _ := c.Get("user")
+
+	tx, err := database.DbConnection.Begin()
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to delete author")
+		return
+	}
+	defer tx.Rollback()
+
+	existingAuthor, err := fetchAuthor(tx, id, true)
+	if err != nil {
+		problem.Respond(c, http.StatusNotFound, "Author not found")
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM authors WHERE id=$1", existingAuthor.ID); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			problem.RespondCode(c, http.StatusConflict, "author_in_use", "Author is still linked to books")
+			return
+		}
+
+		problem.Respond(c, http.StatusInternalServerError, "Failed to delete author")
+		return
+	}
+
+	if err := recordAudit(tx, deletedBy, models.AuditActionDelete, "author", existingAuthor.ID, existingAuthor, nil); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to record audit log")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to delete author")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": i18n.T(c, "Author deleted successfully")})
+}
+
+func GetBooksByAuthorID(c *gin.Context) {
+	authorID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid author id")
+		return
+	}
+
+	q := &queryBuilder{}
+	if role := c.Query("role"); role != "" {
+		q.where("id IN (SELECT book_id FROM book_authors WHERE author_id = %s AND role = %s)", authorID, role)
+	} else {
+		q.where("id IN (SELECT book_id FROM book_authors WHERE author_id = %s)", authorID)
+	}
+	listBooks(c, q)
+}
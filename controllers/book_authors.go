@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/kandlagifari/go-books-apps/database"
+	"github.com/kandlagifari/go-books-apps/models"
+	"github.com/kandlagifari/go-books-apps/problem"
+	"github.com/lib/pq"
+)
+
+// requestedBookAuthors returns the author links submitted with a book, or nil
+// when the request did not mention authors at all. Clients may send either
+// "author_ids" (every entry gets the "author" role) or "authors" with explicit
+// roles; list order becomes the author position.
+func requestedBookAuthors(book *models.Book) ([]models.BookAuthor, error) {
+	if book.Authors == nil && book.AuthorIDs == nil {
+		return nil, nil
+	}
+
+	authors := book.Authors
+	if authors == nil {
+		authors = make([]models.BookAuthor, 0, len(book.AuthorIDs))
+		for _, id := range book.AuthorIDs {
+			authors = append(authors, models.BookAuthor{ID: id})
+		}
+	}
+
+	type link struct {
+		id   int
+		role string
+	}
+	seen := make(map[link]bool, len(authors))
+	ids := make([]int, 0, len(authors))
+	for i := range authors {
+		if authors[i].Role == "" {
+			authors[i].Role = models.AuthorRoleAuthor
+		}
+		if !slices.Contains(models.AuthorRoles, authors[i].Role) {
+			return nil, problem.NewFieldError(fmt.Sprintf("authors[%d].role", i), "oneof", "invalid author role %q", authors[i].Role)
+		}
+
+		key := link{authors[i].ID, authors[i].Role}
+		if seen[key] {
+			return nil, problem.NewFieldError(fmt.Sprintf("authors[%d]", i), "duplicate", "duplicate author %d with role %s", authors[i].ID, authors[i].Role)
+		}
+		seen[key] = true
+
+		authors[i].Position = i
+		if !slices.Contains(ids, authors[i].ID) {
+			ids = append(ids, authors[i].ID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return authors, nil
+	}
+
+	var found int
+	err := database.DbConnection.QueryRow("SELECT COUNT(*) FROM authors WHERE id = ANY($1)", pq.Array(ids)).Scan(&found)
+	if err != nil || found != len(ids) {
+		return nil, problem.NewFieldError("author_ids", "invalid", "invalid author_ids")
+	}
+
+	return authors, nil
+}
+
+func saveBookAuthors(db dbExecutor, bookID int, authors []models.BookAuthor) error {
+	if _, err := db.Exec("DELETE FROM book_authors WHERE book_id=$1", bookID); err != nil {
+		return err
+	}
+
+	for _, author := range authors {
+		_, err := db.Exec("INSERT INTO book_authors (book_id, author_id, role, position) VALUES ($1, $2, $3, $4)",
+			bookID, author.ID, author.Role, author.Position)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadBookAuthors(db dbExecutor, books []models.Book) error {
+	if len(books) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(books))
+	index := make(map[int][]int, len(books))
+	for i := range books {
+		ids[i] = books[i].ID
+		index[books[i].ID] = append(index[books[i].ID], i)
+		books[i].Authors = []models.BookAuthor{}
+	}
+
+	rows, err := db.Query(`
+		SELECT ba.book_id, a.id, a.name, ba.role, ba.position
+		FROM book_authors ba
+		JOIN authors a ON a.id = ba.author_id
+		WHERE ba.book_id = ANY($1)
+		ORDER BY ba.book_id, ba.position
+	`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bookID int
+		var author models.BookAuthor
+		if err := rows.Scan(&bookID, &author.ID, &author.Name, &author.Role, &author.Position); err != nil {
+			return err
+		}
+		for _, i := range index[bookID] {
+			books[i].Authors = append(books[i].Authors, author)
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,261 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/database"
+	"github.com/kandlagifari/go-books-apps/models"
+	"github.com/kandlagifari/go-books-apps/problem"
+	"github.com/kandlagifari/go-books-apps/utils"
+)
+
+const bookColumns = "id, title, COALESCE(isbn10, ''), COALESCE(isbn13, ''), description, image_url, release_year, price, total_page, thickness, category_id, created_at, created_by, modified_at, modified_by, deleted_at, deleted_by, version"
+
+var bookSortColumns = map[string]sortColumn{
+	"title":        {"title", "text"},
+	"price":        {"price", "int"},
+	"release_year": {"release_year", "int"},
+	"created_at":   {"created_at", "timestamp"},
+}
+
+// scanBook reads the columns listed in bookColumns, followed by any extra
+// columns the caller selected after them.
+func scanBook(row rowScanner, book *models.Book, extra ...any) error {
+	dest := []any{&book.ID, &book.Title, &book.ISBN10, &book.ISBN13, &book.Description, &book.ImageURL, &book.ReleaseYear, &book.Price, &book.TotalPage, &book.Thickness, &book.CategoryID, &book.CreatedAt, &book.CreatedBy, &book.ModifiedAt, &book.ModifiedBy, &book.DeletedAt, &book.DeletedBy, &book.Version}
+	return row.Scan(append(dest, extra...)...)
+}
+
+func parseIntParam(c *gin.Context, name string) (int, bool, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return 0, false, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, false, problem.NewFieldError(name, "type", "%s must be an integer", name)
+	}
+	return value, true, nil
+}
+
+func applyBookFilters(c *gin.Context, q *queryBuilder) error {
+	q.conditions = append(q.conditions, "deleted_at IS NULL")
+
+	intFilters := []struct {
+		param     string
+		condition string
+	}{
+		{"category_id", "category_id = %s"},
+		{"release_year", "release_year = %s"},
+		{"release_year_min", "release_year >= %s"},
+		{"release_year_max", "release_year <= %s"},
+		{"price_min", "price >= %s"},
+		{"price_max", "price <= %s"},
+	}
+	for _, filter := range intFilters {
+		value, ok, err := parseIntParam(c, filter.param)
+		if err != nil {
+			return err
+		}
+		if ok {
+			q.where(filter.condition, value)
+		}
+	}
+
+	if thickness := c.Query("thickness"); thickness != "" {
+		q.where("thickness = %s", thickness)
+	}
+	if createdBy := c.Query("created_by"); createdBy != "" {
+		q.where("created_by = %s", createdBy)
+	}
+
+	if err := applyTagFilter(c, q); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func parseSort(c *gin.Context, allowed map[string]sortColumn, fallback string) (string, string, error) {
+	field := c.DefaultQuery("sort", fallback)
+	if _, ok := allowed[field]; !ok {
+		keys := make([]string, 0, len(allowed))
+		for key := range allowed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return "", "", problem.NewFieldError("sort", "oneof", "sort must be one of: %s", strings.Join(keys, ", "))
+	}
+
+	order := strings.ToLower(c.DefaultQuery("order", "asc"))
+	if order != "asc" && order != "desc" {
+		return "", "", problem.NewFieldError("order", "oneof", "order must be asc or desc")
+	}
+
+	return field, order, nil
+}
+
+func bookSortValue(book *models.Book, field string) string {
+	switch field {
+	case "title":
+		return book.Title
+	case "price":
+		return strconv.Itoa(book.Price)
+	case "release_year":
+		return strconv.Itoa(book.ReleaseYear)
+	default:
+		return book.CreatedAt.Format(time.RFC3339Nano)
+	}
+}
+
+func queryBooks(query string, args ...any) ([]models.Book, error) {
+	rows, err := database.DbConnection.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	books := []models.Book{}
+	for rows.Next() {
+		var book models.Book
+		if err := scanBook(rows, &book); err != nil {
+			return nil, err
+		}
+		books = append(books, book)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return books, loadBookRelations(database.DbConnection, books)
+}
+
+// loadBookRelations fills in the authors and tags of the given books.
+func loadBookRelations(db dbExecutor, books []models.Book) error {
+	if err := loadBookAuthors(db, books); err != nil {
+		return err
+	}
+	return loadBookTags(db, books)
+}
+
+// loadBookRelationsFor fills in the authors and tags of a single book, such as
+// one just read back from an INSERT or UPDATE ... RETURNING.
+func loadBookRelationsFor(db dbExecutor, book *models.Book) error {
+	books := []models.Book{*book}
+	if err := loadBookRelations(db, books); err != nil {
+		return err
+	}
+	*book = books[0]
+	return nil
+}
+
+// fetchBook loads a single book with its authors and tags, including trashed books.
+// Pass forUpdate inside a transaction to lock the row until commit.
+func fetchBook(db dbExecutor, id any, forUpdate bool) (*models.Book, error) {
+	query := "SELECT " + bookColumns + " FROM books WHERE id=$1"
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+
+	var book models.Book
+	if err := scanBook(db.QueryRow(query, id), &book); err != nil {
+		return nil, err
+	}
+
+	books := []models.Book{book}
+	if err := loadBookRelations(db, books); err != nil {
+		return nil, err
+	}
+	return &books[0], nil
+}
+
+func listBooks(c *gin.Context, q *queryBuilder) {
+	if err := applyBookFilters(c, q); err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if usesCursor(c) {
+		listBooksByCursor(c, q)
+		return
+	}
+
+	sortField, order, err := parseSort(c, bookSortColumns, "created_at")
+	if err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	pagination, err := utils.ParsePagination(c.Request.URL.Query())
+	if err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	var total int
+	countQuery := "SELECT COUNT(*) FROM books" + q.whereClause()
+	if err := database.DbConnection.QueryRow(countQuery, q.args...).Scan(&total); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to fetch books")
+		return
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM books%s ORDER BY %s %s, id %s LIMIT %s OFFSET %s",
+		bookColumns, q.whereClause(), bookSortColumns[sortField].column, order, order,
+		q.arg(pagination.Limit()), q.arg(pagination.Offset()))
+
+	books, err := queryBooks(query, q.args...)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to fetch books")
+		return
+	}
+
+	localizeBooks(c, books)
+	pagination.SetTotal(total, c.Request.URL)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       books,
+		"pagination": pagination,
+	})
+}
+
+func listBooksByCursor(c *gin.Context, q *queryBuilder) {
+	page, err := parseKeyset(c, "books", bookSortColumns, "created_at")
+	if err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	page.apply(q)
+	query := "SELECT " + bookColumns + " FROM books" + q.whereClause() + page.orderAndLimit(q)
+
+	books, err := queryBooks(query, q.args...)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to fetch books")
+		return
+	}
+
+	var next *utils.Cursor
+	if len(books) > page.limit {
+		books = books[:page.limit]
+		last := &books[len(books)-1]
+		next = page.next(bookSortValue(last, page.sort), last.ID)
+	}
+
+	localizeBooks(c, books)
+	page.respond(c, books, next)
+}
+
+// recordBookAudit reloads the book inside the transaction and logs it against
+// the snapshot taken before the change. before is nil for newly created books.
+func recordBookAudit(db dbExecutor, actor any, action string, id int, before *models.Book) error {
+	after, err := fetchBook(db, id, false)
+	if err != nil {
+		return err
+	}
+	return recordAudit(db, actor, action, "book", id, before, after)
+}
@@ -1,133 +1,266 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/kandlagifari/go-books-apps/database"
+	"github.com/kandlagifari/go-books-apps/i18n"
 	"github.com/kandlagifari/go-books-apps/models"
+	"github.com/kandlagifari/go-books-apps/problem"
+	"github.com/kandlagifari/go-books-apps/rules"
+	"github.com/kandlagifari/go-books-apps/utils"
 	"github.com/lib/pq"
 )
 
-func GetBooks(c *gin.Context) {
-	rows, err := database.DbConnection.Query("SELECT * FROM books")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books"})
-		return
-	}
-	defer rows.Close()
+var (
+	errInvalidCategory = problem.NewFieldError("category_id", "not_found", "Invalid category_id")
+	errInvalidISBN     = problem.NewFieldError("isbn", "isbn", "Invalid ISBN")
+	errISBNMismatch    = problem.NewFieldError("isbn", "isbn_mismatch", "isbn, isbn10 and isbn13 must identify the same book")
+	errDuplicateISBN   = errors.New("A book with this ISBN already exists")
+)
 
-	var books []models.Book
-	for rows.Next() {
-		var book models.Book
-		if err := rows.Scan(&book.ID, &book.Title, &book.Description, &book.ImageURL, &book.ReleaseYear, &book.Price, &book.TotalPage, &book.Thickness, &book.CategoryID, &book.CreatedAt, &book.CreatedBy, &book.ModifiedAt, &book.ModifiedBy); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse book"})
-			return
+// normalizeBookISBN validates whichever of isbn, isbn10 and isbn13 were sent
+// and fills in both stored forms from them.
+func normalizeBookISBN(book *models.Book) error {
+	var isbn13 string
+	for _, raw := range []string{book.ISBN, book.ISBN10, book.ISBN13} {
+		if raw == "" {
+			continue
+		}
+		_, normalized, err := utils.NormalizeISBN(raw)
+		if err != nil {
+			return errInvalidISBN
+		}
+		if isbn13 != "" && isbn13 != normalized {
+			return errISBNMismatch
 		}
-		books = append(books, book)
+		isbn13 = normalized
 	}
 
-	c.JSON(http.StatusOK, books)
+	if isbn13 != "" {
+		book.ISBN10, book.ISBN13 = utils.ISBN13To10(isbn13), isbn13
+	}
+	book.ISBN = ""
+	return nil
+}
+
+func hasISBN(book *models.Book) bool {
+	return book.ISBN13 != ""
+}
+
+// prepareBook applies the rules shared by every path that writes a book:
+// the field constraints declared on models.Book, the release year window,
+// the derived thickness, a valid ISBN and an existing category. Import and
+// PATCH do not go through request binding, so the constraints are checked
+// here as well.
+func prepareBook(book *models.Book) error {
+	if err := binding.Validator.ValidateStruct(book); err != nil {
+		return err
+	}
+
+	if err := normalizeBookISBN(book); err != nil {
+		return err
+	}
+
+	if !rules.Default.ValidReleaseYear(book.ReleaseYear) {
+		minYear, maxYear := rules.Default.ReleaseYears()
+		return problem.NewFieldError("release_year", "range", "Release year must be between %d and %d", minYear, maxYear)
+	}
+
+	book.Thickness = rules.Default.Thickness(book.TotalPage)
+
+	if !categoryExists(book.CategoryID) {
+		return errInvalidCategory
+	}
+
+	return nil
+}
+
+func insertBook(db dbExecutor, book *models.Book, createdBy any, createdAt time.Time) error {
+	query := `
+		INSERT INTO books (title, isbn10, isbn13, description, image_url, release_year, price, total_page, thickness, category_id, created_by, created_at)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING ` + bookColumns
+	return scanBook(db.QueryRow(query, book.Title, book.ISBN10, book.ISBN13, book.Description, book.ImageURL, book.ReleaseYear, book.Price, book.TotalPage, book.Thickness, book.CategoryID, createdBy, createdAt), book)
+}
+
+func updateBook(db dbExecutor, id int, book *models.Book, updatedBy any, updatedAt time.Time) error {
+	query := `
+		UPDATE books 
+		SET title=$1, isbn10=NULLIF($2, ''), isbn13=NULLIF($3, ''), description=$4, image_url=$5, release_year=$6, price=$7, total_page=$8, thickness=$9, category_id=$10, modified_at=$11, modified_by=$12 
+		WHERE id=$13
+		RETURNING ` + bookColumns
+	return scanBook(db.QueryRow(query, book.Title, book.ISBN10, book.ISBN13, book.Description, book.ImageURL, book.ReleaseYear, book.Price, book.TotalPage, book.Thickness, book.CategoryID, updatedAt, updatedBy, id), book)
+}
+
+// localizeBooks labels the thickness of each book in the request's language.
+func localizeBooks(c *gin.Context, books []models.Book) {
+	for i := range books {
+		books[i].ThicknessLabel = i18n.ThicknessLabel(c, books[i].Thickness)
+	}
+}
+
+func GetBooks(c *gin.Context) {
+	listBooks(c, &queryBuilder{})
 }
 
 func CreateBook(c *gin.Context) {
 	var book models.Book
 	if err := c.ShouldBindJSON(&book); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		problem.FromError(c, http.StatusBadRequest, err)
 		return
 	}
 
-	if book.ReleaseYear < 1980 || book.ReleaseYear > 2024 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Release year must be between 1980 and 2024"})
+	updatedBy, exists := c.Get("user")
+	if !exists || updatedBy == nil {
+		problem.Respond(c, http.StatusUnauthorized, "User context missing")
 		return
 	}
 
-	if book.TotalPage > 100 {
-		book.Thickness = "tebal"
-	} else {
-		book.Thickness = "tipis"
-	}
-
-	updatedBy, exists := c.Get("user")
-	if !exists || updatedBy == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User context missing"})
+	if err := prepareBook(&book); err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
 		return
 	}
 
-	var categoryExists bool
-	err := database.DbConnection.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE id=$1)", book.CategoryID).Scan(&categoryExists)
-	if err != nil || !categoryExists {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category_id"})
+	authors, err := requestedBookAuthors(&book)
+	if err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	createdAt := time.Now()
 
-	query := `
-		INSERT INTO books (title, description, image_url, release_year, price, total_page, thickness, category_id, created_by, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-	`
-	_, err = database.DbConnection.Exec(query, book.Title, book.Description, book.ImageURL, book.ReleaseYear, int(book.Price), book.TotalPage, book.Thickness, book.CategoryID, updatedBy, createdAt)
+	tx, err := database.DbConnection.Begin()
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to create book")
+		return
+	}
+	defer tx.Rollback()
+
+	err = insertBook(tx, &book, updatedBy, createdAt)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
-			c.JSON(http.StatusConflict, gin.H{"error": "Book title must be unique"})
+			problem.RespondCode(c, http.StatusConflict, "duplicate_isbn", errDuplicateISBN.Error())
 			return
 		}
 
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create book"})
+		problem.Respond(c, http.StatusInternalServerError, "Failed to create book")
+		return
+	}
+
+	if err := saveBookAuthors(tx, book.ID, authors); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to save book authors")
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Book created successfully"})
+	if err := recordBookAudit(tx, updatedBy, models.AuditActionCreate, book.ID, nil); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to record audit log")
+		return
+	}
+
+	if err := loadBookRelationsFor(tx, &book); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to create book")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to create book")
+		return
+	}
+
+	book.ThicknessLabel = i18n.ThicknessLabel(c, book.Thickness)
+	respondWritten(c, http.StatusCreated, fmt.Sprintf("/api/books/%d", book.ID), book.Version, &book, "Book created successfully")
 }
 
 func GetBookByID(c *gin.Context) {
 	id := c.Param("id")
 
-	var book models.Book
-	err := database.DbConnection.QueryRow("SELECT * FROM books WHERE id=$1", id).
-		Scan(&book.ID, &book.Title, &book.Description, &book.ImageURL, &book.ReleaseYear, &book.Price, &book.TotalPage, &book.Thickness, &book.CategoryID, &book.CreatedAt, &book.CreatedBy, &book.ModifiedAt, &book.ModifiedBy)
+	book, err := fetchBook(database.DbConnection, id, false)
+	if err != nil || book.DeletedAt.Valid {
+		problem.Respond(c, http.StatusNotFound, "Book not found")
+		return
+	}
+
+	if notModified(c, book.Version) {
+		return
+	}
+
+	book.ThicknessLabel = i18n.ThicknessLabel(c, book.Thickness)
+	c.JSON(http.StatusOK, book)
+}
+
+func GetBookByISBN(c *gin.Context) {
+	_, isbn13, err := utils.NormalizeISBN(c.Param("isbn"))
+	if err != nil {
+		problem.FromError(c, http.StatusBadRequest, errInvalidISBN)
+		return
+	}
+
+	var id int
+	err = database.DbConnection.QueryRow("SELECT id FROM books WHERE isbn13=$1 AND deleted_at IS NULL", isbn13).Scan(&id)
+	if err != nil {
+		problem.Respond(c, http.StatusNotFound, "Book not found")
+		return
+	}
+
+	book, err := fetchBook(database.DbConnection, id, false)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		problem.Respond(c, http.StatusInternalServerError, "Failed to fetch book")
 		return
 	}
 
-	response := gin.H{
-		"id":           book.ID,
-		"title":        book.Title,
-		"description":  book.Description,
-		"image_url":    book.ImageURL,
-		"release_year": book.ReleaseYear,
-		"price":        book.Price,
-		"total_page":   book.TotalPage,
-		"thickness":    book.Thickness,
-		"category_id":  book.CategoryID,
-		"created_at":   book.CreatedAt,
-		"created_by":   book.CreatedBy.String,
-		"modified_at":  book.ModifiedAt,
-		"modified_by":  book.ModifiedBy.String,
+	if notModified(c, book.Version) {
+		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	book.ThicknessLabel = i18n.ThicknessLabel(c, book.Thickness)
+	c.JSON(http.StatusOK, book)
 }
 
 func DeleteBook(c *gin.Context) {
 	id := c.Param("id")
 
-	result, err := database.DbConnection.Exec("DELETE FROM books WHERE id=$1", id)
+	deletedBy, _ := c.Get("user")
+
+	tx, err := database.DbConnection.Begin()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete book"})
+		problem.Respond(c, http.StatusInternalServerError, "Failed to delete book")
+		return
+	}
+	defer tx.Rollback()
+
+	existingBook, err := fetchBook(tx, id, true)
+	if err != nil || existingBook.DeletedAt.Valid {
+		problem.Respond(c, http.StatusNotFound, "Book not found")
+		return
+	}
+
+	if !checkIfMatch(c, existingBook.Version) {
+		return
+	}
+
+	_, err = tx.Exec("UPDATE books SET deleted_at=NOW(), deleted_by=$1 WHERE id=$2", deletedBy, existingBook.ID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to delete book")
+		return
+	}
+
+	if err := recordBookAudit(tx, deletedBy, models.AuditActionDelete, existingBook.ID, existingBook); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to record audit log")
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+	if err := tx.Commit(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to delete book")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Book deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": i18n.T(c, "Book deleted successfully")})
 }
 
 func UpdateBook(c *gin.Context) {
@@ -135,44 +268,80 @@ func UpdateBook(c *gin.Context) {
 	var book models.Book
 
 	if err := c.ShouldBindJSON(&book); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		problem.FromError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	updatedBy, _ := c.Get("user")
 
-	if book.ReleaseYear < 1980 || book.ReleaseYear > 2024 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Release year must be between 1980 and 2024"})
+	if err := prepareBook(&book); err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
 		return
 	}
 
-	if book.TotalPage > 100 {
-		book.Thickness = "tebal"
-	} else {
-		book.Thickness = "tipis"
+	authors, err := requestedBookAuthors(&book)
+	if err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
+		return
 	}
 
-	var existingBook models.Book
-	err := database.DbConnection.QueryRow("SELECT * FROM books WHERE id=$1", id).
-		Scan(&existingBook.ID, &existingBook.Title, &existingBook.Description, &existingBook.ImageURL, &existingBook.ReleaseYear, &existingBook.Price, &existingBook.TotalPage, &existingBook.Thickness, &existingBook.CategoryID, &existingBook.CreatedAt, &existingBook.CreatedBy, &existingBook.ModifiedAt, &existingBook.ModifiedBy)
+	updatedAt := time.Now()
 
+	tx, err := database.DbConnection.Begin()
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		problem.Respond(c, http.StatusInternalServerError, "Failed to update book")
 		return
 	}
+	defer tx.Rollback()
 
-	updatedAt := time.Now()
+	existingBook, err := fetchBook(tx, id, true)
+	if err != nil || existingBook.DeletedAt.Valid {
+		problem.Respond(c, http.StatusNotFound, "Book not found")
+		return
+	}
 
-	query := `
-		UPDATE books 
-		SET title=$1, description=$2, image_url=$3, release_year=$4, price=$5, total_page=$6, thickness=$7, category_id=$8, modified_at=$9, modified_by=$10 
-		WHERE id=$11
-	`
-	_, err = database.DbConnection.Exec(query, book.Title, book.Description, book.ImageURL, book.ReleaseYear, book.Price, book.TotalPage, book.Thickness, book.CategoryID, updatedAt, updatedBy, id)
+	if !checkIfMatch(c, existingBook.Version) {
+		return
+	}
+
+	// Like authors, the ISBN is left alone when the request does not mention it.
+	if !hasISBN(&book) {
+		book.ISBN10, book.ISBN13 = existingBook.ISBN10, existingBook.ISBN13
+	}
+
+	err = updateBook(tx, existingBook.ID, &book, updatedBy, updatedAt)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update book"})
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			problem.RespondCode(c, http.StatusConflict, "duplicate_isbn", errDuplicateISBN.Error())
+			return
+		}
+
+		problem.Respond(c, http.StatusInternalServerError, "Failed to update book")
+		return
+	}
+
+	if authors != nil {
+		if err := saveBookAuthors(tx, existingBook.ID, authors); err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "Failed to save book authors")
+			return
+		}
+	}
+
+	if err := recordBookAudit(tx, updatedBy, models.AuditActionUpdate, existingBook.ID, existingBook); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to record audit log")
+		return
+	}
+
+	if err := loadBookRelationsFor(tx, &book); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to update book")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to update book")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Book updated successfully"})
+	book.ThicknessLabel = i18n.ThicknessLabel(c, book.Thickness)
+	respondWritten(c, http.StatusOK, "", book.Version, &book, "Book updated successfully")
 }
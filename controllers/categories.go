@@ -1,22 +1,67 @@
 package controllers
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/kandlagifari/go-books-apps/database"
+	"github.com/kandlagifari/go-books-apps/i18n"
 	"github.com/kandlagifari/go-books-apps/models"
+	"github.com/kandlagifari/go-books-apps/problem"
+	"github.com/kandlagifari/go-books-apps/utils"
 	"github.com/lib/pq"
 )
 
+const categoryColumns = "id, name, parent_id, created_at, created_by, modified_at, modified_by, deleted_at, deleted_by, version"
+
+var categorySortColumns = map[string]sortColumn{
+	"name":       {"name", "text"},
+	"created_at": {"created_at", "timestamp"},
+}
+
+func scanCategory(row rowScanner, category *models.Category) error {
+	return row.Scan(&category.ID, &category.Name, &category.ParentID, &category.CreatedAt, &category.CreatedBy, &category.ModifiedAt, &category.ModifiedBy, &category.DeletedAt, &category.DeletedBy, &category.Version)
+}
+
+func fetchCategory(db dbExecutor, id any, forUpdate bool) (*models.Category, error) {
+	query := "SELECT " + categoryColumns + " FROM categories WHERE id=$1"
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+
+	var category models.Category
+	if err := scanCategory(db.QueryRow(query, id), &category); err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+func recordCategoryAudit(db dbExecutor, actor any, action string, id int, before *models.Category) error {
+	after, err := fetchCategory(db, id, false)
+	if err != nil {
+		return err
+	}
+	return recordAudit(db, actor, action, "category", id, before, after)
+}
+
+func categoryExists(id int) bool {
+	var exists bool
+	err := database.DbConnection.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE id=$1 AND deleted_at IS NULL)", id).Scan(&exists)
+	return err == nil && exists
+}
+
 func GetCategories(c *gin.Context) {
-	rows, err := database.DbConnection.Query(`
-        SELECT id, name, created_at, created_by, modified_at, modified_by 
-        FROM categories
-    `)
+	if usesCursor(c) {
+		listCategoriesByCursor(c)
+		return
+	}
+
+	rows, err := database.DbConnection.Query("SELECT " + categoryColumns + " FROM categories WHERE deleted_at IS NULL")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		problem.Respond(c, http.StatusInternalServerError, "Failed to fetch categories")
 		return
 	}
 	defer rows.Close()
@@ -24,15 +69,8 @@ func GetCategories(c *gin.Context) {
 	var categories []models.Category
 	for rows.Next() {
 		var category models.Category
-		if err := rows.Scan(
-			&category.ID,
-			&category.Name,
-			&category.CreatedAt,
-			&category.CreatedBy,
-			&category.ModifiedAt,
-			&category.ModifiedBy,
-		); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse category"})
+		if err := scanCategory(rows, &category); err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "Failed to parse category")
 			return
 		}
 		categories = append(categories, category)
@@ -41,97 +79,234 @@ func GetCategories(c *gin.Context) {
 	c.JSON(http.StatusOK, categories)
 }
 
+func listCategoriesByCursor(c *gin.Context) {
+	page, err := parseKeyset(c, "categories", categorySortColumns, "name")
+	if err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	q := &queryBuilder{conditions: []string{"deleted_at IS NULL"}}
+	page.apply(q)
+	query := "SELECT " + categoryColumns + " FROM categories" + q.whereClause() + page.orderAndLimit(q)
+
+	rows, err := database.DbConnection.Query(query, q.args...)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to fetch categories")
+		return
+	}
+	defer rows.Close()
+
+	categories := []models.Category{}
+	for rows.Next() {
+		var category models.Category
+		if err := scanCategory(rows, &category); err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "Failed to parse category")
+			return
+		}
+		categories = append(categories, category)
+	}
+
+	var next *utils.Cursor
+	if len(categories) > page.limit {
+		categories = categories[:page.limit]
+		last := categories[len(categories)-1]
+		value := last.Name
+		if page.sort == "created_at" {
+			value = last.CreatedAt.Format(time.RFC3339Nano)
+		}
+		next = page.next(value, last.ID)
+	}
+
+	page.respond(c, categories, next)
+}
+
 func CreateCategory(c *gin.Context) {
 	var category models.Category
 	if err := c.ShouldBindJSON(&category); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		problem.FromError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	createdBy, _ := c.Get("user")
 
+	tx, err := database.DbConnection.Begin()
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to create category")
+		return
+	}
+	defer tx.Rollback()
+
+	if category.ParentID != nil {
+		if err := lockParentCategory(tx, *category.ParentID); err != nil {
+			if err == errInvalidParent {
+				problem.FromError(c, http.StatusBadRequest, err)
+				return
+			}
+			problem.Respond(c, http.StatusInternalServerError, "Failed to create category")
+			return
+		}
+	}
+
 	query := `
-		INSERT INTO categories (name, created_by, created_at)
-		VALUES ($1, $2, $3)
-	`
+		INSERT INTO categories (name, parent_id, created_by, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ` + categoryColumns
 	createdAt := time.Now()
 
-	_, err := database.DbConnection.Exec(query, category.Name, createdBy, createdAt)
+	err = scanCategory(tx.QueryRow(query, category.Name, category.ParentID, createdBy, createdAt), &category)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
-			c.JSON(http.StatusConflict, gin.H{"error": "Category name must be unique"})
+			problem.RespondCode(c, http.StatusConflict, "duplicate_name", "Category name must be unique")
 			return
 		}
 
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create category"})
+		problem.Respond(c, http.StatusInternalServerError, "Failed to create category")
+		return
+	}
+
+	if err := recordCategoryAudit(tx, createdBy, models.AuditActionCreate, category.ID, nil); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to record audit log")
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Category created successfully"})
+	if err := tx.Commit(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to create category")
+		return
+	}
+
+	respondWritten(c, http.StatusCreated, fmt.Sprintf("/api/categories/%d", category.ID), category.Version, &category, "Category created successfully")
 }
 
 func GetCategoryByID(c *gin.Context) {
 	id := c.Param("id")
 
-	var category models.Category
-	err := database.DbConnection.QueryRow("SELECT * FROM categories WHERE id=$1", id).
-		Scan(&category.ID, &category.Name, &category.CreatedAt, &category.CreatedBy, &category.ModifiedAt, &category.ModifiedBy)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+	category, err := fetchCategory(database.DbConnection, id, false)
+	if err != nil || category.DeletedAt.Valid {
+		problem.Respond(c, http.StatusNotFound, "Category not found")
+		return
+	}
+
+	if notModified(c, category.Version) {
 		return
 	}
 
-	response := gin.H{
+	c.JSON(http.StatusOK, categoryResponse(category))
+}
+
+func categoryResponse(category *models.Category) gin.H {
+	return gin.H{
 		"id":          category.ID,
 		"name":        category.Name,
+		"parent_id":   category.ParentID,
 		"created_at":  category.CreatedAt,
 		"created_by":  category.CreatedBy.String,
 		"modified_at": category.ModifiedAt,
 		"modified_by": category.ModifiedBy.String,
+		"version":     category.Version,
 	}
-
-	c.JSON(http.StatusOK, response)
 }
 
+// DeleteCategory moves a category to the trash. Subcategories have to be
+// moved or deleted first. A category that still has books is only deleted
+// with ?cascade=true, in which case its books are trashed with the same
+// timestamp so restoring the category brings them back.
 func DeleteCategory(c *gin.Context) {
 	id := c.Param("id")
+	cascade := c.Query("cascade") == "true"
+	deletedBy, _ := c.Get("user")
 
-	result, err := database.DbConnection.Exec("DELETE FROM categories WHERE id=$1", id)
+	tx, err := database.DbConnection.Begin()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
+		problem.Respond(c, http.StatusInternalServerError, "Failed to delete category")
 		return
 	}
+	defer tx.Rollback()
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+	existingCategory, err := fetchCategory(tx, id, true)
+	if err != nil || existingCategory.DeletedAt.Valid {
+		problem.Respond(c, http.StatusNotFound, "Category not found")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
-}
+	if !checkIfMatch(c, existingCategory.Version) {
+		return
+	}
 
-func GetBooksByCategoryID(c *gin.Context) {
-	id := c.Param("id")
+	var hasChildren bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE parent_id=$1 AND deleted_at IS NULL)", existingCategory.ID).Scan(&hasChildren)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to delete category")
+		return
+	}
+	if hasChildren {
+		problem.RespondCode(c, http.StatusConflict, "category_not_empty", "Category still has subcategories, move or delete them first")
+		return
+	}
 
-	rows, err := database.DbConnection.Query("SELECT * FROM books WHERE category_id=$1", id)
+	var deletedAt time.Time
+	err = tx.QueryRow("UPDATE categories SET deleted_at=NOW(), deleted_by=$1 WHERE id=$2 RETURNING deleted_at", deletedBy, existingCategory.ID).Scan(&deletedAt)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books"})
+		problem.Respond(c, http.StatusInternalServerError, "Failed to delete category")
 		return
 	}
-	defer rows.Close()
 
-	var books []models.Book
-	for rows.Next() {
-		var book models.Book
-		if err := rows.Scan(&book.ID, &book.Title, &book.Description, &book.ImageURL, &book.ReleaseYear, &book.Price, &book.TotalPage, &book.Thickness, &book.CategoryID, &book.CreatedAt, &book.CreatedBy, &book.ModifiedAt, &book.ModifiedBy); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse book"})
+	bookIDs, err := lockIDs(tx, "SELECT id FROM books WHERE category_id=$1 AND deleted_at IS NULL ORDER BY id FOR UPDATE", existingCategory.ID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to delete category")
+		return
+	}
+
+	if len(bookIDs) > 0 && !cascade {
+		problem.RespondCode(c, http.StatusConflict, "category_not_empty", "Category still has books, pass ?cascade=true to delete them as well")
+		return
+	}
+
+	for _, bookID := range bookIDs {
+		before, err := fetchBook(tx, bookID, false)
+		if err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "Failed to delete category books")
 			return
 		}
-		books = append(books, book)
+
+		if _, err := tx.Exec("UPDATE books SET deleted_at=$1, deleted_by=$2 WHERE id=$3", deletedAt, deletedBy, bookID); err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "Failed to delete category books")
+			return
+		}
+
+		if err := recordBookAudit(tx, deletedBy, models.AuditActionDelete, bookID, before); err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "Failed to record audit log")
+			return
+		}
+	}
+
+	if err := recordCategoryAudit(tx, deletedBy, models.AuditActionDelete, existingCategory.ID, existingCategory); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to record audit log")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to delete category")
+		return
 	}
 
-	c.JSON(http.StatusOK, books)
+	c.JSON(http.StatusOK, gin.H{"message": i18n.T(c, "Category deleted successfully")})
+}
+
+func GetBooksByCategoryID(c *gin.Context) {
+	categoryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid category id")
+		return
+	}
+
+	q := &queryBuilder{}
+	if c.Query("include_descendants") == "true" {
+		q.where("category_id IN ("+categorySubtreeQuery+")", categoryID)
+	} else {
+		q.where("category_id = %s", categoryID)
+	}
+	listBooks(c, q)
 }
 
 func UpdateCategory(c *gin.Context) {
@@ -139,29 +314,52 @@ func UpdateCategory(c *gin.Context) {
 	var category models.Category
 
 	if err := c.ShouldBindJSON(&category); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		problem.FromError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	updatedBy, _ := c.Get("user")
 
-	var existingCategory models.Category
-	err := database.DbConnection.QueryRow("SELECT * FROM categories WHERE id=$1", id).
-		Scan(&existingCategory.ID, &existingCategory.Name, &existingCategory.CreatedAt, &existingCategory.CreatedBy, &existingCategory.ModifiedAt, &existingCategory.ModifiedBy)
-
+	tx, err := database.DbConnection.Begin()
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		problem.Respond(c, http.StatusInternalServerError, "Failed to update category")
+		return
+	}
+	defer tx.Rollback()
+
+	existingCategory, err := fetchCategory(tx, id, true)
+	if err != nil || existingCategory.DeletedAt.Valid {
+		problem.Respond(c, http.StatusNotFound, "Category not found")
+		return
+	}
+
+	if !checkIfMatch(c, existingCategory.Version) {
 		return
 	}
 
 	updatedAt := time.Now()
 
-	query := `UPDATE categories SET name=$1, modified_at=$2, modified_by=$3 WHERE id=$4`
-	_, err = database.DbConnection.Exec(query, category.Name, updatedAt, updatedBy, id)
+	query := `UPDATE categories SET name=$1, modified_at=$2, modified_by=$3 WHERE id=$4 RETURNING ` + categoryColumns
+	err = scanCategory(tx.QueryRow(query, category.Name, updatedAt, updatedBy, existingCategory.ID), &category)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update category"})
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			problem.RespondCode(c, http.StatusConflict, "duplicate_name", "Category name must be unique")
+			return
+		}
+
+		problem.Respond(c, http.StatusInternalServerError, "Failed to update category")
+		return
+	}
+
+	if err := recordCategoryAudit(tx, updatedBy, models.AuditActionUpdate, existingCategory.ID, existingCategory); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to record audit log")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to update category")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Category updated successfully"})
+	respondWritten(c, http.StatusOK, "", category.Version, &category, "Category updated successfully")
 }
@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/database"
+	"github.com/kandlagifari/go-books-apps/i18n"
+	"github.com/kandlagifari/go-books-apps/models"
+	"github.com/kandlagifari/go-books-apps/problem"
+)
+
+// categorySubtreeQuery selects the live category bound to %s together with
+// all of its live descendants.
+const categorySubtreeQuery = `
+	WITH RECURSIVE subtree AS (
+		SELECT id FROM categories WHERE id = %s AND deleted_at IS NULL
+		UNION ALL
+		SELECT child.id FROM categories child JOIN subtree ON child.parent_id = subtree.id
+		WHERE child.deleted_at IS NULL
+	)
+	SELECT id FROM subtree`
+
+var errInvalidParent = problem.NewFieldError("parent_id", "not_found", "Invalid parent_id")
+
+// lockParentCategory checks that a would-be parent is live and holds a share
+// lock on it, so it cannot be trashed while a child is attached to it.
+func lockParentCategory(db dbExecutor, parentID int) error {
+	var id int
+	err := db.QueryRow("SELECT id FROM categories WHERE id=$1 AND deleted_at IS NULL FOR SHARE", parentID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return errInvalidParent
+	}
+	return err
+}
+
+// isDescendant reports whether candidate lies in the subtree rooted at
+// categoryID, the category itself included.
+func isDescendant(db dbExecutor, categoryID, candidate int) (bool, error) {
+	var found bool
+	err := db.QueryRow(`
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM categories WHERE id = $1
+			UNION ALL
+			SELECT child.id FROM categories child JOIN subtree ON child.parent_id = subtree.id
+		)
+		SELECT EXISTS(SELECT 1 FROM subtree WHERE id = $2)
+	`, categoryID, candidate).Scan(&found)
+	return found, err
+}
+
+func GetCategoryTree(c *gin.Context) {
+	rows, err := database.DbConnection.Query("SELECT id, name, parent_id FROM categories WHERE deleted_at IS NULL ORDER BY name, id")
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to fetch categories")
+		return
+	}
+	defer rows.Close()
+
+	var nodes []*models.CategoryNode
+	byID := map[int]*models.CategoryNode{}
+	for rows.Next() {
+		node := &models.CategoryNode{Children: []*models.CategoryNode{}}
+		if err := rows.Scan(&node.ID, &node.Name, &node.ParentID); err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "Failed to parse category")
+			return
+		}
+		nodes = append(nodes, node)
+		byID[node.ID] = node
+	}
+
+	roots := []*models.CategoryNode{}
+	for _, node := range nodes {
+		if node.ParentID != nil {
+			if parent, ok := byID[*node.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+
+	c.JSON(http.StatusOK, roots)
+}
+
+// MoveCategory re-parents a category, or makes it a root when parent_id is
+// null. Moves take a table lock so two concurrent moves cannot each pass the
+// cycle check and still produce a loop together.
+func MoveCategory(c *gin.Context) {
+	id := c.Param("id")
+
+	var input struct {
+		ParentID *int `json:"parent_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	updatedBy, _ := c.Get("user")
+
+	tx, err := database.DbConnection.Begin()
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to move category")
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("LOCK TABLE categories IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to move category")
+		return
+	}
+
+	existingCategory, err := fetchCategory(tx, id, true)
+	if err != nil || existingCategory.DeletedAt.Valid {
+		problem.Respond(c, http.StatusNotFound, "Category not found")
+		return
+	}
+
+	if !checkIfMatch(c, existingCategory.Version) {
+		return
+	}
+
+	if input.ParentID != nil {
+		if err := lockParentCategory(tx, *input.ParentID); err != nil {
+			if err == errInvalidParent {
+				problem.FromError(c, http.StatusBadRequest, err)
+				return
+			}
+			problem.Respond(c, http.StatusInternalServerError, "Failed to move category")
+			return
+		}
+
+		cycle, err := isDescendant(tx, existingCategory.ID, *input.ParentID)
+		if err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "Failed to move category")
+			return
+		}
+		if cycle {
+			problem.RespondCode(c, http.StatusConflict, "category_cycle", "A category cannot be moved under itself or one of its subcategories")
+			return
+		}
+	}
+
+	_, err = tx.Exec("UPDATE categories SET parent_id=$1, modified_at=$2, modified_by=$3 WHERE id=$4", input.ParentID, time.Now(), updatedBy, existingCategory.ID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to move category")
+		return
+	}
+
+	if err := recordCategoryAudit(tx, updatedBy, models.AuditActionUpdate, existingCategory.ID, existingCategory); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to record audit log")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to move category")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": i18n.T(c, "Category moved successfully")})
+}
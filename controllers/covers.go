@@ -0,0 +1,283 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/database"
+	"github.com/kandlagifari/go-books-apps/i18n"
+	"github.com/kandlagifari/go-books-apps/models"
+	"github.com/kandlagifari/go-books-apps/problem"
+	"github.com/kandlagifari/go-books-apps/storage"
+	"github.com/kandlagifari/go-books-apps/utils"
+)
+
+var (
+	MaxCoverSize int64 = 5 << 20
+	// MaxCoverPixels bounds the decoded bitmap, about 16 MB at 4 bytes per
+	// pixel, whatever the size of the compressed file.
+	MaxCoverPixels = 4_000_000
+)
+
+const coverOriginal = "original"
+
+var coverSizes = map[string]int{
+	"small":  160,
+	"medium": 480,
+}
+
+var coverContentTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+// bookCover names the stored files of a book's current cover.
+type bookCover struct {
+	bookID int
+	token  string
+}
+
+func (b bookCover) key(size string) string {
+	if b.token == "" {
+		return fmt.Sprintf("covers/%d/%s", b.bookID, size)
+	}
+	return fmt.Sprintf("covers/%d/%s/%s", b.bookID, b.token, size)
+}
+
+func currentCover(db dbExecutor, bookID int) (bookCover, error) {
+	cover := bookCover{bookID: bookID}
+	err := db.QueryRow("SELECT COALESCE(cover_token, '') FROM books WHERE id=$1", bookID).Scan(&cover.token)
+	return cover, err
+}
+
+func coverURL(bookID int) string {
+	return fmt.Sprintf("%s/api/books/%d/cover", strings.TrimRight(AppBaseURL, "/"), bookID)
+}
+
+// readCover reads the uploaded file and checks that it really is an image we
+// can decode, whatever the client claimed it was.
+func readCover(c *gin.Context) ([]byte, string, image.Image, int, error) {
+	// Leave some room for the multipart framing around the file itself.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MaxCoverSize+64<<10)
+
+	file, header, err := c.Request.FormFile("cover")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, "", nil, http.StatusRequestEntityTooLarge, i18n.Errorf("Cover must be at most %d bytes", MaxCoverSize)
+		}
+		return nil, "", nil, http.StatusBadRequest, i18n.Errorf("A cover file is required")
+	}
+	defer file.Close()
+
+	if header.Size > MaxCoverSize {
+		return nil, "", nil, http.StatusRequestEntityTooLarge, i18n.Errorf("Cover must be at most %d bytes", MaxCoverSize)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, MaxCoverSize+1))
+	if err != nil {
+		return nil, "", nil, http.StatusBadRequest, i18n.Errorf("Failed to read cover")
+	}
+	if int64(len(data)) > MaxCoverSize {
+		return nil, "", nil, http.StatusRequestEntityTooLarge, i18n.Errorf("Cover must be at most %d bytes", MaxCoverSize)
+	}
+
+	contentType := http.DetectContentType(data)
+	allowed := false
+	for _, candidate := range coverContentTypes {
+		allowed = allowed || candidate == contentType
+	}
+	if !allowed {
+		return nil, "", nil, http.StatusUnsupportedMediaType, i18n.Errorf("Cover must be a JPEG, PNG or GIF image")
+	}
+
+	// Check the dimensions before decoding so a tiny file that expands into a
+	// huge bitmap is refused cheaply.
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", nil, http.StatusUnsupportedMediaType, i18n.Errorf("Cover image could not be decoded")
+	}
+	if config.Width*config.Height > MaxCoverPixels {
+		return nil, "", nil, http.StatusRequestEntityTooLarge, i18n.Errorf("Cover must be at most %d pixels", MaxCoverPixels)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", nil, http.StatusUnsupportedMediaType, i18n.Errorf("Cover image could not be decoded")
+	}
+
+	return data, contentType, img, 0, nil
+}
+
+// storeCover saves the original upload and one thumbnail per size. PNGs keep
+// their format so transparency survives; everything else becomes JPEG.
+func storeCover(cover bookCover, data []byte, contentType string, img image.Image) error {
+	if err := storage.Default.Put(cover.key(coverOriginal), bytes.NewReader(data), contentType); err != nil {
+		return err
+	}
+
+	for size, side := range coverSizes {
+		var buf bytes.Buffer
+		thumbType := "image/jpeg"
+		thumb := utils.Thumbnail(img, side)
+
+		var err error
+		if contentType == "image/png" {
+			thumbType = "image/png"
+			err = png.Encode(&buf, thumb)
+		} else {
+			err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85})
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := storage.Default.Put(cover.key(size), &buf, thumbType); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeBookCovers drops stored covers that no book points at any more, such
+// as those of purged books or a replaced cover. It runs after the change has
+// committed and only logs failures, since nothing serves the files either way.
+func removeBookCovers(covers []bookCover) {
+	for _, cover := range covers {
+		for _, size := range append([]string{coverOriginal}, coverSizeNames()...) {
+			if err := storage.Default.Delete(cover.key(size)); err != nil {
+				log.Println("removing book cover failed:", err)
+			}
+		}
+	}
+}
+
+func coverSizeNames() []string {
+	names := make([]string, 0, len(coverSizes))
+	for name := range coverSizes {
+		names = append(names, name)
+	}
+	return names
+}
+
+func UploadBookCover(c *gin.Context) {
+	id := c.Param("id")
+	updatedBy, _ := c.Get("user")
+
+	data, contentType, img, status, err := readCover(c)
+	if err != nil {
+		problem.FromError(c, status, err)
+		return
+	}
+
+	tx, err := database.DbConnection.Begin()
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to upload cover")
+		return
+	}
+	defer tx.Rollback()
+
+	existingBook, err := fetchBook(tx, id, true)
+	if err != nil || existingBook.DeletedAt.Valid {
+		problem.Respond(c, http.StatusNotFound, "Book not found")
+		return
+	}
+
+	if !checkIfMatch(c, existingBook.Version) {
+		return
+	}
+
+	previous, err := currentCover(tx, existingBook.ID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to upload cover")
+		return
+	}
+
+	// The files go under a new name, so the cover being served is untouched
+	// until the book points at the new one when the transaction commits.
+	token, err := utils.RandomToken(8)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to upload cover")
+		return
+	}
+	uploaded := bookCover{bookID: existingBook.ID, token: token}
+	committed := false
+	defer func() {
+		if !committed {
+			removeBookCovers([]bookCover{uploaded})
+		}
+	}()
+
+	if err := storeCover(uploaded, data, contentType, img); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to store cover")
+		return
+	}
+
+	imageURL := coverURL(existingBook.ID)
+	_, err = tx.Exec("UPDATE books SET image_url=$1, cover_token=$2, modified_at=$3, modified_by=$4 WHERE id=$5", imageURL, token, time.Now(), updatedBy, existingBook.ID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to upload cover")
+		return
+	}
+
+	if err := recordBookAudit(tx, updatedBy, models.AuditActionUpdate, existingBook.ID, existingBook); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to record audit log")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to upload cover")
+		return
+	}
+	committed = true
+	removeBookCovers([]bookCover{previous})
+
+	c.JSON(http.StatusOK, gin.H{"message": i18n.T(c, "Book cover uploaded successfully"), "image_url": imageURL})
+}
+
+func GetBookCover(c *gin.Context) {
+	size := c.DefaultQuery("size", coverOriginal)
+	if _, ok := coverSizes[size]; !ok && size != coverOriginal {
+		problem.Respond(c, http.StatusBadRequest, "size must be one of: original, medium, small")
+		return
+	}
+
+	var cover bookCover
+	err := database.DbConnection.QueryRow("SELECT id, COALESCE(cover_token, '') FROM books WHERE id=$1 AND deleted_at IS NULL", c.Param("id")).Scan(&cover.bookID, &cover.token)
+	if err != nil {
+		problem.Respond(c, http.StatusNotFound, "Book not found")
+		return
+	}
+
+	blob, err := storage.Default.Get(cover.key(size))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			problem.Respond(c, http.StatusNotFound, "Book has no cover")
+			return
+		}
+		problem.Respond(c, http.StatusInternalServerError, "Failed to read cover")
+		return
+	}
+	defer blob.Close()
+
+	c.Header("Content-Type", blob.ContentType)
+	c.Header("Cache-Control", "public, max-age=300")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	// Seekable blobs get conditional and range requests for free.
+	if seeker, ok := blob.ReadCloser.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, "", blob.ModTime, seeker)
+		return
+	}
+
+	c.DataFromReader(http.StatusOK, blob.Size, blob.ContentType, blob, nil)
+}
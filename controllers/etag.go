@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/problem"
+)
+
+// RequireIfMatch makes If-Match mandatory on writes to versioned resources.
+// When false, a missing header means the client accepts last-write-wins.
+var RequireIfMatch = false
+
+func versionETag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+func etagList(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// notModified sets the ETag of a GET response and answers 304 when the client
+// already holds that version. If-None-Match uses weak comparison.
+func notModified(c *gin.Context, version int) bool {
+	etag := versionETag(version)
+	c.Header("ETag", etag)
+
+	for _, tag := range etagList(c.GetHeader("If-None-Match")) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch guards a write against a stale copy. It must be called after
+// the row is locked so the version cannot change before the write. If-Match
+// uses strong comparison, so weak tags never match.
+func checkIfMatch(c *gin.Context, version int) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		if RequireIfMatch {
+			problem.RespondCode(c, http.StatusPreconditionRequired, "if_match_required", "If-Match header is required")
+			return false
+		}
+		return true
+	}
+
+	etag := versionETag(version)
+	for _, tag := range etagList(header) {
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+
+	c.Header("ETag", etag)
+	problem.Respond(c, http.StatusPreconditionFailed, "Resource was modified by someone else, fetch it again")
+	return false
+}
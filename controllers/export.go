@@ -0,0 +1,309 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/database"
+	"github.com/kandlagifari/go-books-apps/models"
+	"github.com/kandlagifari/go-books-apps/problem"
+	"github.com/kandlagifari/go-books-apps/utils"
+)
+
+// exportFlushEvery controls how many rows are buffered before they are pushed
+// to the client as a chunk.
+const exportFlushEvery = 500
+
+var exportColumns = []string{
+	"id", "title", "isbn10", "isbn13", "description", "image_url", "release_year", "price", "total_page", "thickness",
+	"category_id", "category_name", "author_ids", "authors", "tags",
+	"created_at", "created_by", "modified_at", "modified_by",
+}
+
+// exportQueryColumns resolves the category name, authors and tags in the same row
+// so the export never has to collect books in memory to batch-load them.
+const exportQueryColumns = bookColumns + `,
+	COALESCE((SELECT name FROM categories WHERE categories.id = books.category_id), ''),
+	COALESCE((
+		SELECT json_agg(json_build_object('id', a.id, 'name', a.name, 'role', ba.role, 'position', ba.position) ORDER BY ba.position)
+		FROM book_authors ba
+		JOIN authors a ON a.id = ba.author_id
+		WHERE ba.book_id = books.id
+	), '[]'),
+	COALESCE((
+		SELECT json_agg(t.slug ORDER BY t.slug)
+		FROM book_tags bt
+		JOIN tags t ON t.id = bt.tag_id
+		WHERE bt.book_id = books.id
+	), '[]')`
+
+type exportedBook struct {
+	models.CustomBook
+	CategoryName string `json:"category_name"`
+}
+
+type exportWriter interface {
+	write(book *exportedBook) error
+	flush() error
+	close() error
+}
+
+var exportFormats = map[string]struct {
+	contentType string
+	open        func(c *gin.Context) (exportWriter, error)
+}{
+	"csv":    {"text/csv; charset=utf-8", newCSVExport},
+	"ndjson": {"application/x-ndjson", newNDJSONExport},
+	"xlsx":   {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", newXLSXExport},
+}
+
+// formulaPrefix reports whether a spreadsheet would read value as a formula,
+// or whether value is itself an escaped formula, which is escaped once more
+// so that unescapeFormula gives it back unchanged.
+func formulaPrefix(value string) bool {
+	if value == "" {
+		return false
+	}
+	switch value[0] {
+	case '=', '+', '-', '@', '\t', '\r':
+		return true
+	case '\'':
+		return formulaPrefix(value[1:])
+	}
+	return false
+}
+
+// escapeFormula keeps user text such as a title starting with "=" from being
+// run as a formula when a CSV export is opened in a spreadsheet.
+func escapeFormula(value string) string {
+	if formulaPrefix(value) {
+		return "'" + value
+	}
+	return value
+}
+
+// unescapeFormula undoes escapeFormula, so an exported CSV imports as the
+// original text.
+func unescapeFormula(value string) string {
+	if rest, ok := strings.CutPrefix(value, "'"); ok && formulaPrefix(rest) {
+		return rest
+	}
+	return value
+}
+
+func exportRecord(book *exportedBook) []any {
+	authorIDs := make([]string, len(book.Authors))
+	authorNames := make([]string, len(book.Authors))
+	for i, author := range book.Authors {
+		authorIDs[i] = strconv.Itoa(author.ID)
+		authorNames[i] = author.Name
+	}
+
+	return []any{
+		book.ID, book.Title, book.ISBN10, book.ISBN13, book.Description, book.ImageURL, book.ReleaseYear, book.Price, book.TotalPage, book.Thickness,
+		book.CategoryID, book.CategoryName, strings.Join(authorIDs, ";"), strings.Join(authorNames, "; "), strings.Join(book.Tags, ";"),
+		book.CreatedAt.Format(time.RFC3339), book.CreatedBy, book.ModifiedAt.Format(time.RFC3339), book.ModifiedBy,
+	}
+}
+
+type csvExport struct {
+	c      *gin.Context
+	writer *csv.Writer
+}
+
+func newCSVExport(c *gin.Context) (exportWriter, error) {
+	writer := csv.NewWriter(c.Writer)
+	return &csvExport{c: c, writer: writer}, writer.Write(exportColumns)
+}
+
+func (e *csvExport) write(book *exportedBook) error {
+	values := exportRecord(book)
+	record := make([]string, len(values))
+	for i, value := range values {
+		// Only text can be mistaken for a formula; numbers are left alone so
+		// negative ones stay numbers. XLSX needs nothing, because its text
+		// cells are inline strings that are never evaluated.
+		if text, ok := value.(string); ok {
+			record[i] = escapeFormula(text)
+		} else {
+			record[i] = fmt.Sprint(value)
+		}
+	}
+	return e.writer.Write(record)
+}
+
+func (e *csvExport) flush() error {
+	e.writer.Flush()
+	e.c.Writer.Flush()
+	return e.writer.Error()
+}
+
+func (e *csvExport) close() error {
+	return e.flush()
+}
+
+type ndjsonExport struct {
+	c       *gin.Context
+	encoder *json.Encoder
+}
+
+func newNDJSONExport(c *gin.Context) (exportWriter, error) {
+	return &ndjsonExport{c: c, encoder: json.NewEncoder(c.Writer)}, nil
+}
+
+func (e *ndjsonExport) write(book *exportedBook) error {
+	return e.encoder.Encode(book)
+}
+
+func (e *ndjsonExport) flush() error {
+	e.c.Writer.Flush()
+	return nil
+}
+
+func (e *ndjsonExport) close() error {
+	return e.flush()
+}
+
+type xlsxExport struct {
+	c      *gin.Context
+	writer *utils.XLSXWriter
+}
+
+func newXLSXExport(c *gin.Context) (exportWriter, error) {
+	writer, err := utils.NewXLSXWriter(c.Writer, "Books")
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]any, len(exportColumns))
+	for i, column := range exportColumns {
+		header[i] = column
+	}
+	return &xlsxExport{c: c, writer: writer}, writer.WriteRow(header)
+}
+
+func (e *xlsxExport) write(book *exportedBook) error {
+	return e.writer.WriteRow(exportRecord(book))
+}
+
+func (e *xlsxExport) flush() error {
+	if err := e.writer.Flush(); err != nil {
+		return err
+	}
+	e.c.Writer.Flush()
+	return nil
+}
+
+func (e *xlsxExport) close() error {
+	if err := e.writer.Close(); err != nil {
+		return err
+	}
+	e.c.Writer.Flush()
+	return nil
+}
+
+// ExportBooks streams the filtered catalogue straight from the database
+// cursor. Once the first byte is sent the status can no longer change, so a
+// failure half way through drops the connection instead of ending the body
+// cleanly and leaving the client with a silently truncated file.
+func ExportBooks(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	exporter, ok := exportFormats[format]
+	if !ok {
+		problem.Respond(c, http.StatusBadRequest, "format must be one of: csv, ndjson, xlsx")
+		return
+	}
+
+	q := &queryBuilder{}
+	if err := applyBookFilters(c, q); err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	sortField, order, err := parseSort(c, bookSortColumns, "created_at")
+	if err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM books%s ORDER BY %s %s, id %s",
+		exportQueryColumns, q.whereClause(), bookSortColumns[sortField].column, order, order)
+
+	rows, err := database.DbConnection.QueryContext(c.Request.Context(), query, q.args...)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to export books")
+		return
+	}
+	defer rows.Close()
+
+	filename := fmt.Sprintf("books-%s.%s", time.Now().Format("20060102-150405"), format)
+	c.Header("Content-Type", exporter.contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	// abort cuts the connection so the client sees a broken transfer. A
+	// panic with http.ErrAbortHandler would not do, because gin.Recovery
+	// catches it and the response would end normally.
+	abort := func(err error) {
+		log.Println("book export failed:", err)
+		conn, _, hijackErr := http.NewResponseController(c.Writer).Hijack()
+		if hijackErr != nil {
+			panic(http.ErrAbortHandler)
+		}
+		conn.Close()
+		c.Abort()
+	}
+
+	writer, err := exporter.open(c)
+	if err != nil {
+		abort(err)
+		return
+	}
+
+	var book models.Book
+	var categoryName string
+	var authors, tags []byte
+	for count := 1; rows.Next(); count++ {
+		book = models.Book{}
+		if err := scanBook(rows, &book, &categoryName, &authors, &tags); err != nil {
+			abort(err)
+			return
+		}
+		if err := json.Unmarshal(authors, &book.Authors); err != nil {
+			abort(err)
+			return
+		}
+		if err := json.Unmarshal(tags, &book.Tags); err != nil {
+			abort(err)
+			return
+		}
+
+		if err := writer.write(&exportedBook{CustomBook: book.ToCustom(), CategoryName: categoryName}); err != nil {
+			abort(err)
+			return
+		}
+		if count%exportFlushEvery == 0 {
+			if err := writer.flush(); err != nil {
+				abort(err)
+				return
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		abort(err)
+		return
+	}
+
+	if err := writer.close(); err != nil {
+		abort(err)
+		return
+	}
+}
@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/database"
+	"github.com/kandlagifari/go-books-apps/problem"
+)
+
+// readinessPingTimeout bounds the database check of a readiness probe.
+const readinessPingTimeout = 2 * time.Second
+
+var shuttingDown atomic.Bool
+
+// BeginShutdown makes readiness fail so load balancers stop sending traffic
+// while in-flight requests drain.
+func BeginShutdown() {
+	shuttingDown.Store(true)
+}
+
+// Liveness reports that the process is up. It keeps passing during shutdown
+// so the process is not restarted while it drains.
+func Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readiness reports whether the server should receive traffic.
+func Readiness(c *gin.Context) {
+	if shuttingDown.Load() {
+		problem.RespondCode(c, http.StatusServiceUnavailable, "shutting_down", "Server is shutting down")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessPingTimeout)
+	defer cancel()
+	if err := database.DbConnection.PingContext(ctx); err != nil {
+		problem.RespondCode(c, http.StatusServiceUnavailable, "database_unavailable", "Database is unavailable")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ready"})
+}
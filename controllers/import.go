@@ -0,0 +1,460 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/database"
+	"github.com/kandlagifari/go-books-apps/i18n"
+	"github.com/kandlagifari/go-books-apps/models"
+	"github.com/kandlagifari/go-books-apps/problem"
+	"github.com/lib/pq"
+)
+
+const (
+	importStatusCreated  = "created"
+	importStatusUpdated  = "updated"
+	importStatusRejected = "rejected"
+)
+
+var importUpsertModes = []string{"none", "title", "isbn"}
+
+// MaxImportSize caps the body of an import. Rows are streamed, so the limit
+// protects the database and the request deadline rather than memory.
+var MaxImportSize int64 = 64 << 20
+
+type importRow struct {
+	Row    int    `json:"row"`
+	Status string `json:"status"`
+	BookID int    `json:"book_id,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type importReport struct {
+	DryRun    bool           `json:"dry_run"`
+	Atomic    bool           `json:"atomic"`
+	Upsert    string         `json:"upsert"`
+	Committed bool           `json:"committed"`
+	Summary   map[string]int `json:"summary"`
+	Rows      []importRow    `json:"rows"`
+}
+
+// importFailure is sent when the stream or the database fails part way.
+// Without ?atomic=true the rows before the failure are already saved, so the
+// report goes along with the problem.
+type importFailure struct {
+	*problem.Problem
+	importReport
+}
+
+type importOptions struct {
+	upsert string
+	dryRun bool
+	atomic bool
+}
+
+// importSource yields one book per call and io.EOF once the input is drained.
+// A non-EOF error that is an importRowError only rejects that row; anything
+// else means the stream itself is broken.
+type importSource func() (*models.Book, error)
+
+type importRowError struct {
+	err error
+}
+
+func (e importRowError) Error() string {
+	return e.err.Error()
+}
+
+// message describes the rejection in the request's language.
+func (e importRowError) message(c *gin.Context) string {
+	violations := problem.Violations(c, e.err)
+	if len(violations) == 0 {
+		return i18n.Error(c, e.err)
+	}
+	messages := make([]string, len(violations))
+	for i, violation := range violations {
+		messages[i] = violation.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+func importFormat(c *gin.Context) string {
+	if format := c.Query("format"); format != "" {
+		return format
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		return "csv"
+	case "application/x-ndjson", "application/jsonl":
+		return "ndjson"
+	}
+	return ""
+}
+
+func csvSource(body io.Reader) (importSource, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, i18n.Errorf("CSV header row is missing")
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, i18n.Errorf("CSV header must contain a title column")
+	}
+
+	return func() (*models.Book, error) {
+		record, err := reader.Read()
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return nil, importRowError{err}
+			}
+			return nil, err
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(unescapeFormula(record[i]))
+			}
+			return ""
+		}
+		number := func(name string) (int, error) {
+			raw := field(name)
+			if raw == "" {
+				return 0, nil
+			}
+			value, err := strconv.Atoi(raw)
+			if err != nil {
+				return 0, importRowError{i18n.Errorf("%s must be an integer", name)}
+			}
+			return value, nil
+		}
+
+		book := &models.Book{
+			Title:       field("title"),
+			ISBN:        field("isbn"),
+			ISBN10:      field("isbn10"),
+			ISBN13:      field("isbn13"),
+			Description: field("description"),
+			ImageURL:    field("image_url"),
+		}
+		for name, dest := range map[string]*int{
+			"release_year": &book.ReleaseYear,
+			"price":        &book.Price,
+			"total_page":   &book.TotalPage,
+			"category_id":  &book.CategoryID,
+		} {
+			if *dest, err = number(name); err != nil {
+				return nil, err
+			}
+		}
+
+		if raw := field("author_ids"); raw != "" {
+			for _, part := range strings.FieldsFunc(raw, func(r rune) bool { return r == ';' || r == '|' }) {
+				id, err := strconv.Atoi(strings.TrimSpace(part))
+				if err != nil {
+					return nil, importRowError{i18n.Errorf("author_ids must be integers separated by ';'")}
+				}
+				book.AuthorIDs = append(book.AuthorIDs, id)
+			}
+		}
+
+		return book, nil
+	}, nil
+}
+
+func ndjsonSource(body io.Reader) importSource {
+	decoder := json.NewDecoder(body)
+
+	return func() (*models.Book, error) {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			var tooLarge *http.MaxBytesError
+			if err == io.EOF || errors.As(err, &tooLarge) {
+				return nil, err
+			}
+			// A syntax error leaves the decoder in an unknown position, so the
+			// rest of the stream cannot be trusted.
+			return nil, i18n.Errorf("invalid JSON: %v", err)
+		}
+
+		var book models.Book
+		if err := json.Unmarshal(raw, &book); err != nil {
+			return nil, importRowError{i18n.Errorf("Invalid input")}
+		}
+		return &book, nil
+	}
+}
+
+// findImportTarget locks and returns the live book a row should update, or 0
+// when the row is new. Titles are no longer unique, so a title that matches
+// several books is the row's fault rather than a guess.
+func findImportTarget(db dbExecutor, book *models.Book, upsert string) (int, error) {
+	var ids []int
+	var err error
+	switch upsert {
+	case "title":
+		ids, err = lockIDs(db, "SELECT id FROM books WHERE title=$1 AND deleted_at IS NULL ORDER BY id FOR UPDATE", book.Title)
+	case "isbn":
+		if !hasISBN(book) {
+			return 0, importRowError{i18n.Errorf("isbn is required when upserting by ISBN")}
+		}
+		ids, err = lockIDs(db, "SELECT id FROM books WHERE isbn13=$1 AND deleted_at IS NULL FOR UPDATE", book.ISBN13)
+	default:
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	switch len(ids) {
+	case 0:
+		return 0, nil
+	case 1:
+		return ids[0], nil
+	default:
+		return 0, importRowError{i18n.Errorf("Title matches %d books, upsert by isbn instead", len(ids))}
+	}
+}
+
+// importBook writes a single row and reports whether it was created or
+// updated. Errors wrapped in importRowError are the row's fault.
+func importBook(db dbExecutor, book *models.Book, actor any, opts importOptions) (string, error) {
+	if strings.TrimSpace(book.Title) == "" {
+		return "", importRowError{i18n.Errorf("title is required")}
+	}
+	if err := prepareBook(book); err != nil {
+		return "", importRowError{err}
+	}
+	authors, err := requestedBookAuthors(book)
+	if err != nil {
+		return "", importRowError{err}
+	}
+
+	now := time.Now()
+
+	targetID, err := findImportTarget(db, book, opts.upsert)
+	if err != nil {
+		return "", err
+	}
+
+	var existing *models.Book
+	if targetID != 0 {
+		if existing, err = fetchBook(db, targetID, false); err != nil {
+			return "", err
+		}
+		if !hasISBN(book) {
+			book.ISBN10, book.ISBN13 = existing.ISBN10, existing.ISBN13
+		}
+	}
+
+	status := importStatusCreated
+	action := models.AuditActionCreate
+	if existing != nil {
+		status, action = importStatusUpdated, models.AuditActionUpdate
+		book.ID = existing.ID
+		err = updateBook(db, book.ID, book, actor, now)
+	} else {
+		err = insertBook(db, book, actor, now)
+	}
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return "", importRowError{errDuplicateISBN}
+		}
+		return "", err
+	}
+
+	if authors != nil || existing == nil {
+		if err := saveBookAuthors(db, book.ID, authors); err != nil {
+			return "", err
+		}
+	}
+
+	if err := recordBookAudit(db, actor, action, book.ID, existing); err != nil {
+		return "", err
+	}
+
+	return status, nil
+}
+
+// ImportBooks streams CSV or NDJSON rows into the catalogue. Without
+// ?atomic=true every row commits on its own; with it, or with ?dry_run=true,
+// all rows share one transaction and each row runs under a savepoint so a bad
+// row is reported without aborting the rest.
+func ImportBooks(c *gin.Context) {
+	opts := importOptions{
+		upsert: c.DefaultQuery("upsert", "none"),
+		dryRun: c.Query("dry_run") == "true",
+		atomic: c.Query("atomic") == "true",
+	}
+	validMode := false
+	for _, mode := range importUpsertModes {
+		validMode = validMode || mode == opts.upsert
+	}
+	if !validMode {
+		problem.Respond(c, http.StatusBadRequest, "upsert must be one of: %s", strings.Join(importUpsertModes, ", "))
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MaxImportSize)
+
+	var next importSource
+	switch importFormat(c) {
+	case "csv":
+		source, err := csvSource(c.Request.Body)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			problem.Respond(c, http.StatusRequestEntityTooLarge, "Import must be at most %d bytes", MaxImportSize)
+			return
+		}
+		if err != nil {
+			problem.FromError(c, http.StatusBadRequest, err)
+			return
+		}
+		next = source
+	case "ndjson":
+		next = ndjsonSource(c.Request.Body)
+	default:
+		problem.Respond(c, http.StatusBadRequest, "format must be csv or ndjson")
+		return
+	}
+
+	actor, _ := c.Get("user")
+	shared := opts.dryRun || opts.atomic
+
+	var tx *sql.Tx
+	if shared {
+		var err error
+		if tx, err = database.DbConnection.Begin(); err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "Failed to import books")
+			return
+		}
+		defer tx.Rollback()
+	}
+
+	report := importReport{
+		DryRun:  opts.dryRun,
+		Atomic:  opts.atomic,
+		Upsert:  opts.upsert,
+		Summary: map[string]int{importStatusCreated: 0, importStatusUpdated: 0, importStatusRejected: 0},
+		Rows:    []importRow{},
+	}
+	summary := report.Summary
+	// fail stops the import. Rows committed on their own stay saved, so the
+	// report up to the failing row is sent with the error.
+	fail := func(status int, detail string, args ...any) {
+		report.Committed = !shared && summary[importStatusCreated]+summary[importStatusUpdated] > 0
+		c.Header("Content-Type", problem.ContentType)
+		c.JSON(status, importFailure{
+			Problem:      problem.Complete(c, &problem.Problem{Status: status, Detail: i18n.T(c, detail, args...)}),
+			importReport: report,
+		})
+	}
+
+	for index := 1; ; index++ {
+		book, err := next()
+		if err == io.EOF {
+			break
+		}
+
+		result := importRow{Row: index}
+		var rowErr importRowError
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &rowErr):
+			result.Status, result.Error = importStatusRejected, rowErr.message(c)
+		case errors.As(err, &tooLarge):
+			fail(http.StatusRequestEntityTooLarge, "Import must be at most %d bytes", MaxImportSize)
+			return
+		case err != nil:
+			fail(http.StatusBadRequest, "Row %d: %s", index, i18n.Error(c, err))
+			return
+		default:
+			result.Title = book.Title
+			result.Status, err = importRowIn(tx, book, actor, opts)
+			if errors.As(err, &rowErr) {
+				result.Status, result.Error = importStatusRejected, rowErr.message(c)
+			} else if err != nil {
+				fail(http.StatusInternalServerError, "Failed to import row %d", index)
+				return
+			} else {
+				result.BookID = book.ID
+			}
+		}
+
+		summary[result.Status]++
+		report.Rows = append(report.Rows, result)
+	}
+
+	switch {
+	case opts.dryRun:
+	case opts.atomic && summary[importStatusRejected] > 0:
+	case opts.atomic:
+		if err := tx.Commit(); err != nil {
+			fail(http.StatusInternalServerError, "Failed to import books")
+			return
+		}
+		report.Committed = true
+	default:
+		report.Committed = summary[importStatusCreated]+summary[importStatusUpdated] > 0
+	}
+
+	status := http.StatusOK
+	if opts.atomic && !opts.dryRun && !report.Committed && summary[importStatusRejected] > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+
+	c.JSON(status, report)
+}
+
+// importRowIn runs one row either under a savepoint of the shared transaction
+// or in a transaction of its own.
+func importRowIn(tx *sql.Tx, book *models.Book, actor any, opts importOptions) (string, error) {
+	if tx != nil {
+		if _, err := tx.Exec("SAVEPOINT import_row"); err != nil {
+			return "", err
+		}
+		status, err := importBook(tx, book, actor, opts)
+		if err != nil {
+			if _, rbErr := tx.Exec("ROLLBACK TO SAVEPOINT import_row"); rbErr != nil {
+				return "", rbErr
+			}
+			return "", err
+		}
+		_, err = tx.Exec("RELEASE SAVEPOINT import_row")
+		return status, err
+	}
+
+	rowTx, err := database.DbConnection.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer rowTx.Rollback()
+
+	status, err := importBook(rowTx, book, actor, opts)
+	if err != nil {
+		return "", err
+	}
+	return status, rowTx.Commit()
+}
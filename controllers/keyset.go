@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/problem"
+	"github.com/kandlagifari/go-books-apps/utils"
+)
+
+type sortColumn struct {
+	column string
+	cast   string
+}
+
+type keysetPage struct {
+	scope   string
+	sort    string
+	order   string
+	limit   int
+	after   *utils.Cursor
+	columns map[string]sortColumn
+}
+
+func usesCursor(c *gin.Context) bool {
+	return c.Query("cursor") != "" || c.Query("pagination") == "cursor"
+}
+
+// parseKeyset resolves the sort order for cursor pagination. When a cursor is
+// supplied its embedded sort wins, and an explicit sort/order that disagrees
+// with it is rejected instead of silently producing an inconsistent walk.
+func parseKeyset(c *gin.Context, scope string, columns map[string]sortColumn, fallback string) (*keysetPage, error) {
+	page := &keysetPage{scope: scope, limit: utils.DefaultPageSize, columns: columns}
+
+	if raw := c.Query("page_size"); raw != "" {
+		size, err := strconv.Atoi(raw)
+		if err != nil || size < 1 {
+			return nil, problem.NewFieldError("page_size", "type", "page_size must be a positive integer")
+		}
+		page.limit = min(size, utils.MaxPageSize)
+	}
+
+	if token := c.Query("cursor"); token != "" {
+		cursor, err := utils.DecodeCursor(token)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Scope != scope {
+			return nil, problem.NewFieldError("cursor", "invalid", "cursor does not belong to this listing")
+		}
+		if _, ok := columns[cursor.Sort]; !ok {
+			return nil, problem.NewFieldError("cursor", "invalid", "cursor has an unsupported sort")
+		}
+		if sort := c.Query("sort"); sort != "" && sort != cursor.Sort {
+			return nil, problem.NewFieldError("cursor", "mismatch", "cursor was issued for sort=%s", cursor.Sort)
+		}
+		if order := c.Query("order"); order != "" && order != cursor.Order {
+			return nil, problem.NewFieldError("cursor", "mismatch", "cursor was issued for order=%s", cursor.Order)
+		}
+
+		page.sort, page.order, page.after = cursor.Sort, cursor.Order, cursor
+		return page, nil
+	}
+
+	sort, order, err := parseSort(c, columns, fallback)
+	if err != nil {
+		return nil, err
+	}
+	page.sort, page.order = sort, order
+
+	return page, nil
+}
+
+func (p *keysetPage) comparator() string {
+	if p.order == "desc" {
+		return "<"
+	}
+	return ">"
+}
+
+func (p *keysetPage) apply(q *queryBuilder) {
+	if p.after == nil {
+		return
+	}
+
+	column := p.columns[p.sort]
+	q.where(fmt.Sprintf("(%s, id) %s (%%s::%s, %%s)", column.column, p.comparator(), column.cast), p.after.Value, p.after.ID)
+}
+
+// orderAndLimit fetches one extra row so the caller can tell whether another
+// page exists without a separate COUNT.
+func (p *keysetPage) orderAndLimit(q *queryBuilder) string {
+	column := p.columns[p.sort]
+	return fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %s", column.column, p.order, p.order, q.arg(p.limit+1))
+}
+
+func (p *keysetPage) next(value string, id int) *utils.Cursor {
+	return &utils.Cursor{Scope: p.scope, Sort: p.sort, Order: p.order, Value: value, ID: id}
+}
+
+func (p *keysetPage) respond(c *gin.Context, data any, next *utils.Cursor) {
+	meta := gin.H{
+		"page_size":   p.limit,
+		"sort":        p.sort,
+		"order":       p.order,
+		"next_cursor": nil,
+		"next":        nil,
+	}
+
+	if next != nil {
+		token, err := utils.EncodeCursor(*next)
+		if err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "Failed to encode cursor")
+			return
+		}
+
+		query := c.Request.URL.Query()
+		query.Del("pagination")
+		query.Set("cursor", token)
+		meta["next_cursor"] = token
+		meta["next"] = c.Request.URL.Path + "?" + query.Encode()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       data,
+		"pagination": meta,
+	})
+}
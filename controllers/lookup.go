@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/database"
+	"github.com/kandlagifari/go-books-apps/metadata"
+	"github.com/kandlagifari/go-books-apps/problem"
+	"github.com/kandlagifari/go-books-apps/utils"
+	"github.com/lib/pq"
+)
+
+// matchAuthors maps looked-up author names onto existing authors,
+// case-insensitively, and returns the names that have no match yet.
+func matchAuthors(names []string) ([]int, []string, error) {
+	ids := []int{}
+	unmatched := []string{}
+	if len(names) == 0 {
+		return ids, unmatched, nil
+	}
+
+	lowered := make([]string, len(names))
+	for i, name := range names {
+		lowered[i] = strings.ToLower(strings.TrimSpace(name))
+	}
+
+	rows, err := database.DbConnection.Query("SELECT id, LOWER(name) FROM authors WHERE LOWER(name) = ANY($1) ORDER BY id", pq.Array(lowered))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	known := map[string]int{}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, nil, err
+		}
+		if _, ok := known[name]; !ok {
+			known[name] = id
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	for i, name := range lowered {
+		if id, ok := known[name]; ok {
+			ids = append(ids, id)
+		} else {
+			unmatched = append(unmatched, names[i])
+		}
+	}
+	return ids, unmatched, nil
+}
+
+// draftTextLimit matches the max=255 binding on the text fields of
+// models.Book, which the lookup draft must pass.
+const draftTextLimit = 255
+
+// fitDraftText shortens provider text to draftTextLimit characters, ending it
+// with an ellipsis, and reports whether it had to.
+func fitDraftText(value string) (string, bool) {
+	runes := []rune(value)
+	if len(runes) <= draftTextLimit {
+		return value, false
+	}
+	return strings.TrimSpace(string(runes[:draftTextLimit-1])) + "…", true
+}
+
+// LookupBook fetches metadata for an ISBN and turns it into a draft that can
+// be completed (price, category) and posted to CreateBook as is.
+func LookupBook(c *gin.Context) {
+	_, isbn13, err := utils.NormalizeISBN(c.Query("isbn"))
+	if err != nil {
+		problem.FromError(c, http.StatusBadRequest, errInvalidISBN)
+		return
+	}
+
+	result, cached, err := metadata.Default.Lookup(c.Request.Context(), isbn13)
+	if err != nil {
+		if errors.Is(err, metadata.ErrNotFound) {
+			problem.Respond(c, http.StatusNotFound, "No metadata found for this ISBN")
+			return
+		}
+		log.Println("metadata lookup failed:", err)
+		problem.Respond(c, http.StatusBadGateway, "Metadata providers are unavailable")
+		return
+	}
+
+	authorIDs, unmatchedAuthors, err := matchAuthors(result.Authors)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to match authors")
+		return
+	}
+
+	var existingBookID *int
+	var id int
+	err = database.DbConnection.QueryRow("SELECT id FROM books WHERE isbn13=$1 AND deleted_at IS NULL", isbn13).Scan(&id)
+	if err == nil {
+		existingBookID = &id
+	} else if err != sql.ErrNoRows {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to fetch book")
+		return
+	}
+
+	// Providers have no length limits, so long text is shortened and a URL
+	// that is too long is dropped, since a cut URL points nowhere. The fields
+	// are listed so the client can review them before submitting.
+	shortened := []string{}
+	title, cut := fitDraftText(result.Title)
+	if cut {
+		shortened = append(shortened, "title")
+	}
+	description, cut := fitDraftText(result.Description)
+	if cut {
+		shortened = append(shortened, "description")
+	}
+	imageURL := result.ImageURL
+	if len([]rune(imageURL)) > draftTextLimit {
+		imageURL = ""
+		shortened = append(shortened, "image_url")
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"draft": gin.H{
+			"title":        title,
+			"isbn":         isbn13,
+			"description":  description,
+			"image_url":    imageURL,
+			"release_year": result.ReleaseYear,
+			"price":        0,
+			"total_page":   result.TotalPage,
+			"category_id":  0,
+			"author_ids":   authorIDs,
+		},
+		"shortened_fields":  shortened,
+		"unmatched_authors": unmatchedAuthors,
+		"existing_book_id":  existingBookID,
+		"sources":           result.Sources,
+		"cached":            cached,
+	})
+}
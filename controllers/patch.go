@@ -0,0 +1,268 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/kandlagifari/go-books-apps/database"
+	"github.com/kandlagifari/go-books-apps/i18n"
+	"github.com/kandlagifari/go-books-apps/models"
+	"github.com/kandlagifari/go-books-apps/problem"
+	"github.com/kandlagifari/go-books-apps/utils"
+	"github.com/lib/pq"
+)
+
+const maxPatchSize = 1 << 20
+
+// bookPatchDocument is the editable view of a book that patches are applied
+// to. Derived and bookkeeping fields are left out on purpose, so patching
+// them is rejected instead of silently ignored.
+type bookPatchDocument struct {
+	Title       string            `json:"title"`
+	ISBN        string            `json:"isbn"`
+	Description string            `json:"description"`
+	ImageURL    string            `json:"image_url"`
+	ReleaseYear int               `json:"release_year"`
+	Price       int               `json:"price"`
+	TotalPage   int               `json:"total_page"`
+	CategoryID  int               `json:"category_id"`
+	Authors     []bookPatchAuthor `json:"authors"`
+}
+
+type bookPatchAuthor struct {
+	ID   int    `json:"id"`
+	Role string `json:"role"`
+}
+
+type categoryPatchDocument struct {
+	Name string `json:"name"`
+}
+
+// applyPatch applies the request body to doc and decodes the result into
+// patched. application/json-patch+json selects RFC 6902; merge patch
+// (RFC 7396) is used for application/merge-patch+json and plain JSON.
+func applyPatch(c *gin.Context, doc any, patched any) *problem.Problem {
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+
+	var apply func(doc, patch []byte) ([]byte, error)
+	switch mediaType {
+	case "application/merge-patch+json", "application/json", "":
+		apply = utils.MergePatch
+	case "application/json-patch+json":
+		apply = utils.JSONPatch
+	default:
+		return &problem.Problem{Status: http.StatusUnsupportedMediaType, Detail: i18n.T(c, "Content-Type must be application/merge-patch+json or application/json-patch+json")}
+	}
+
+	patch, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPatchSize+1))
+	if err != nil || len(patch) > maxPatchSize {
+		return &problem.Problem{Status: http.StatusBadRequest, Detail: i18n.T(c, "Invalid input")}
+	}
+
+	original, err := json.Marshal(doc)
+	if err != nil {
+		return &problem.Problem{Status: http.StatusInternalServerError, Detail: i18n.T(c, "Failed to apply patch")}
+	}
+
+	result, err := apply(original, patch)
+	if err != nil {
+		var patchErr *utils.PatchError
+		switch {
+		case errors.Is(err, utils.ErrPatchTestFailed):
+			return &problem.Problem{Status: http.StatusConflict, Code: "patch_test_failed", Detail: i18n.T(c, "Patch test operation failed")}
+		case errors.As(err, &patchErr):
+			return &problem.Problem{Status: http.StatusUnprocessableEntity, Code: "patch_failed", Detail: i18n.T(c, "Cannot apply patch: %s", i18n.T(c, "operation %d: %s", patchErr.Index, i18n.Error(c, patchErr.Err)))}
+		default:
+			return &problem.Problem{Status: http.StatusBadRequest, Code: problem.CodeInvalidJSON, Detail: i18n.T(c, "Invalid patch document")}
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(result))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(patched); err != nil {
+		violations := problem.Violations(c, err)
+		if _, field, found := strings.Cut(err.Error(), "unknown field "); found {
+			field = strings.Trim(field, `"`)
+			violations = []problem.Violation{{Field: field, Code: "read_only", Message: i18n.T(c, "%s cannot be patched", field)}}
+		}
+		return &problem.Problem{Status: http.StatusUnprocessableEntity, Code: problem.CodeValidationFailed, Detail: i18n.T(c, "Patched document is invalid"), Errors: violations}
+	}
+
+	return nil
+}
+
+func PatchBook(c *gin.Context) {
+	id := c.Param("id")
+	updatedBy, _ := c.Get("user")
+
+	tx, err := database.DbConnection.Begin()
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to update book")
+		return
+	}
+	defer tx.Rollback()
+
+	existingBook, err := fetchBook(tx, id, true)
+	if err != nil || existingBook.DeletedAt.Valid {
+		problem.Respond(c, http.StatusNotFound, "Book not found")
+		return
+	}
+
+	if !checkIfMatch(c, existingBook.Version) {
+		return
+	}
+
+	doc := bookPatchDocument{
+		Title:       existingBook.Title,
+		ISBN:        existingBook.ISBN13,
+		Description: existingBook.Description,
+		ImageURL:    existingBook.ImageURL,
+		ReleaseYear: existingBook.ReleaseYear,
+		Price:       existingBook.Price,
+		TotalPage:   existingBook.TotalPage,
+		CategoryID:  existingBook.CategoryID,
+		Authors:     []bookPatchAuthor{},
+	}
+	for _, author := range existingBook.Authors {
+		doc.Authors = append(doc.Authors, bookPatchAuthor{ID: author.ID, Role: author.Role})
+	}
+
+	var patched bookPatchDocument
+	if p := applyPatch(c, doc, &patched); p != nil {
+		problem.Write(c, p)
+		return
+	}
+
+	book := models.Book{
+		Title:       patched.Title,
+		ISBN:        patched.ISBN,
+		Description: patched.Description,
+		ImageURL:    patched.ImageURL,
+		ReleaseYear: patched.ReleaseYear,
+		Price:       patched.Price,
+		TotalPage:   patched.TotalPage,
+		CategoryID:  patched.CategoryID,
+		// Never nil, so removing every author really clears them.
+		Authors: make([]models.BookAuthor, 0, len(patched.Authors)),
+	}
+	for _, author := range patched.Authors {
+		book.Authors = append(book.Authors, models.BookAuthor{ID: author.ID, Role: author.Role})
+	}
+
+	// Derived fields such as thickness are computed from the merged result.
+	if err := prepareBook(&book); err != nil {
+		problem.FromError(c, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	authors, err := requestedBookAuthors(&book)
+	if err != nil {
+		problem.FromError(c, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	err = updateBook(tx, existingBook.ID, &book, updatedBy, time.Now())
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			problem.RespondCode(c, http.StatusConflict, "duplicate_isbn", errDuplicateISBN.Error())
+			return
+		}
+
+		problem.Respond(c, http.StatusInternalServerError, "Failed to update book")
+		return
+	}
+
+	if err := saveBookAuthors(tx, existingBook.ID, authors); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to save book authors")
+		return
+	}
+
+	if err := recordBookAudit(tx, updatedBy, models.AuditActionUpdate, existingBook.ID, existingBook); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to record audit log")
+		return
+	}
+
+	updated, err := fetchBook(tx, existingBook.ID, false)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to update book")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to update book")
+		return
+	}
+
+	updated.ThicknessLabel = i18n.ThicknessLabel(c, updated.Thickness)
+	respondWritten(c, http.StatusOK, "", updated.Version, updated, "Book updated successfully")
+}
+
+func PatchCategory(c *gin.Context) {
+	id := c.Param("id")
+	updatedBy, _ := c.Get("user")
+
+	tx, err := database.DbConnection.Begin()
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to update category")
+		return
+	}
+	defer tx.Rollback()
+
+	existingCategory, err := fetchCategory(tx, id, true)
+	if err != nil || existingCategory.DeletedAt.Valid {
+		problem.Respond(c, http.StatusNotFound, "Category not found")
+		return
+	}
+
+	if !checkIfMatch(c, existingCategory.Version) {
+		return
+	}
+
+	var patched categoryPatchDocument
+	if p := applyPatch(c, categoryPatchDocument{Name: existingCategory.Name}, &patched); p != nil {
+		problem.Write(c, p)
+		return
+	}
+
+	if err := binding.Validator.ValidateStruct(&models.Category{Name: patched.Name}); err != nil {
+		problem.FromError(c, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	_, err = tx.Exec("UPDATE categories SET name=$1, modified_at=$2, modified_by=$3 WHERE id=$4", patched.Name, time.Now(), updatedBy, existingCategory.ID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			problem.RespondCode(c, http.StatusConflict, "duplicate_name", "Category name must be unique")
+			return
+		}
+
+		problem.Respond(c, http.StatusInternalServerError, "Failed to update category")
+		return
+	}
+
+	if err := recordCategoryAudit(tx, updatedBy, models.AuditActionUpdate, existingCategory.ID, existingCategory); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to record audit log")
+		return
+	}
+
+	updated, err := fetchCategory(tx, existingCategory.ID, false)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to update category")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to update category")
+		return
+	}
+
+	respondWritten(c, http.StatusOK, "", updated.Version, updated, "Category updated successfully")
+}
@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/i18n"
+)
+
+// preferMinimal reports whether the client sent Prefer: return=minimal
+// (RFC 7240) and only wants a short confirmation instead of the resource.
+func preferMinimal(c *gin.Context) bool {
+	for _, header := range c.Request.Header.Values("Prefer") {
+		for _, preference := range strings.Split(header, ",") {
+			token, _, _ := strings.Cut(preference, ";")
+			if strings.EqualFold(strings.ReplaceAll(strings.TrimSpace(token), " ", ""), "return=minimal") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// respondWritten answers a successful create or update with the resource as it
+// was stored, its ETag and, when location is set, a Location header. With
+// Prefer: return=minimal only the message is sent.
+func respondWritten(c *gin.Context, status int, location string, version int, resource any, message string) {
+	if location != "" {
+		c.Header("Location", location)
+	}
+	c.Header("ETag", versionETag(version))
+
+	if preferMinimal(c) {
+		c.Header("Preference-Applied", "return=minimal")
+		c.JSON(status, gin.H{"message": i18n.T(c, message)})
+		return
+	}
+	c.JSON(status, resource)
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/database"
+	"github.com/kandlagifari/go-books-apps/i18n"
+	"github.com/kandlagifari/go-books-apps/models"
+	"github.com/kandlagifari/go-books-apps/problem"
+	"github.com/kandlagifari/go-books-apps/rules"
+)
+
+// thicknessSQL renders the thickness buckets as a CASE expression over
+// total_page, matching rules.Rules.Thickness.
+func thicknessSQL(r *rules.Rules) (string, []any) {
+	last := len(r.Buckets) - 1
+	if last == 0 {
+		return "$1::text", []any{r.Buckets[0].Name}
+	}
+
+	var expr strings.Builder
+	var args []any
+
+	expr.WriteString("CASE")
+	for _, bucket := range r.Buckets[:last] {
+		args = append(args, bucket.MaxPages, bucket.Name)
+		fmt.Fprintf(&expr, " WHEN total_page <= $%d THEN $%d::text", len(args)-1, len(args))
+	}
+	args = append(args, r.Buckets[last].Name)
+	fmt.Fprintf(&expr, " ELSE $%d::text END", len(args))
+
+	return expr.String(), args
+}
+
+func GetRules(c *gin.Context) {
+	minYear, maxYear := rules.Default.ReleaseYears()
+
+	buckets := make([]gin.H, len(rules.Default.Buckets))
+	for i, bucket := range rules.Default.Buckets {
+		buckets[i] = gin.H{"name": bucket.Name, "label": i18n.ThicknessLabel(c, bucket.Name)}
+		if i < len(buckets)-1 {
+			buckets[i]["max_pages"] = bucket.MaxPages
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"release_year": gin.H{
+			"min": minYear,
+			"max": maxYear,
+		},
+		"thickness": buckets,
+	})
+}
+
+// RecomputeThickness reclassifies stored books, trashed ones included, after
+// the thickness buckets were changed. Only books whose thickness changes are
+// updated, and each of them gets an audit entry.
+func RecomputeThickness(c *gin.Context) {
+	actor, _ := c.Get("user")
+
+	tx, err := database.DbConnection.Begin()
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to recompute thickness")
+		return
+	}
+	defer tx.Rollback()
+
+	expr, args := thicknessSQL(rules.Default)
+	ids, err := lockIDs(tx, "SELECT id FROM books WHERE thickness IS DISTINCT FROM "+expr+" ORDER BY id FOR UPDATE", args...)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to recompute thickness")
+		return
+	}
+
+	for _, id := range ids {
+		before, err := fetchBook(tx, id, false)
+		if err == nil {
+			_, err = tx.Exec("UPDATE books SET thickness=$1, modified_by=$2 WHERE id=$3", rules.Default.Thickness(before.TotalPage), actor, id)
+		}
+		if err == nil {
+			err = recordBookAudit(tx, actor, models.AuditActionUpdate, id, before)
+		}
+		if err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "Failed to recompute thickness")
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to recompute thickness")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": i18n.T(c, "Thickness recomputed successfully"),
+		"updated": len(ids),
+	})
+}
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/database"
+	"github.com/kandlagifari/go-books-apps/models"
+	"github.com/kandlagifari/go-books-apps/problem"
+	"github.com/kandlagifari/go-books-apps/utils"
+)
+
+// Postgres marks matches with private-use characters instead of <mark>, so
+// the stored text can be HTML-escaped before the real tags are put in.
+const (
+	searchMarkStart = "\ue000"
+	searchMarkStop  = "\ue001"
+
+	searchHeadlineOptions = "StartSel=" + searchMarkStart + ", StopSel=" + searchMarkStop + ", MaxFragments=2, MaxWords=30, MinWords=10"
+)
+
+var searchMarkReplacer = strings.NewReplacer(searchMarkStart, "<mark>", searchMarkStop, "</mark>")
+
+// highlightHTML turns a ts_headline fragment into safe HTML: the text is
+// escaped and only the match markers become tags.
+func highlightHTML(headline string) string {
+	return searchMarkReplacer.Replace(html.EscapeString(headline))
+}
+
+// buildPrefixQuery turns free text into a tsquery where every term must match
+// as a prefix, e.g. "dr sto" becomes "dr:* & sto:*". Anything that is not a
+// letter or digit is dropped so user input can never inject tsquery operators.
+func buildPrefixQuery(input string) string {
+	terms := strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i, term := range terms {
+		terms[i] = term + ":*"
+	}
+	return strings.Join(terms, " & ")
+}
+
+func SearchBooks(c *gin.Context) {
+	tsquery := buildPrefixQuery(c.Query("q"))
+	if tsquery == "" {
+		problem.Respond(c, http.StatusBadRequest, "Query parameter q is required")
+		return
+	}
+
+	q := &queryBuilder{}
+	queryArg := q.arg(tsquery)
+	q.conditions = append(q.conditions, fmt.Sprintf("search_vector @@ to_tsquery('simple', %s)", queryArg))
+
+	if err := applyBookFilters(c, q); err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	pagination, err := utils.ParsePagination(c.Request.URL.Query())
+	if err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	var total int
+	if err := database.DbConnection.QueryRow("SELECT COUNT(*) FROM books"+q.whereClause(), q.args...).Scan(&total); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to search books")
+		return
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %[1]s,
+			ts_rank(search_vector, to_tsquery('simple', %[2]s)) AS rank,
+			ts_headline('simple', title, to_tsquery('simple', %[2]s), '%[3]s'),
+			ts_headline('simple', coalesce(description, ''), to_tsquery('simple', %[2]s), '%[3]s')
+		FROM books%[4]s
+		ORDER BY rank DESC, id ASC
+		LIMIT %[5]s OFFSET %[6]s
+	`, bookColumns, queryArg, searchHeadlineOptions, q.whereClause(), q.arg(pagination.Limit()), q.arg(pagination.Offset()))
+
+	rows, err := database.DbConnection.Query(query, q.args...)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to search books")
+		return
+	}
+	defer rows.Close()
+
+	type searchHit struct {
+		rank                 float64
+		titleHighlight       string
+		descriptionHighlight string
+	}
+
+	books := []models.Book{}
+	hits := []searchHit{}
+	for rows.Next() {
+		var book models.Book
+		var hit searchHit
+		if err := scanBook(rows, &book, &hit.rank, &hit.titleHighlight, &hit.descriptionHighlight); err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "Failed to parse book")
+			return
+		}
+		books = append(books, book)
+		hits = append(hits, hit)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to search books")
+		return
+	}
+
+	if err := loadBookRelations(database.DbConnection, books); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to search books")
+		return
+	}
+
+	localizeBooks(c, books)
+	results := make([]gin.H, len(books))
+	for i := range books {
+		results[i] = gin.H{
+			"book": &books[i],
+			"rank": hits[i].rank,
+			"highlight": gin.H{
+				"title":       highlightHTML(hits[i].titleHighlight),
+				"description": highlightHTML(hits[i].descriptionHighlight),
+			},
+		}
+	}
+
+	pagination.SetTotal(total, c.Request.URL)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       results,
+		"pagination": pagination,
+	})
+}
@@ -0,0 +1,260 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/database"
+	"github.com/kandlagifari/go-books-apps/models"
+	"github.com/kandlagifari/go-books-apps/problem"
+	"github.com/kandlagifari/go-books-apps/utils"
+	"github.com/lib/pq"
+)
+
+// normalizeTags slugs every tag and drops duplicates while keeping the order
+// they were given in.
+func normalizeTags(raw []string) ([]string, error) {
+	tags := make([]string, 0, len(raw))
+	seen := map[string]bool{}
+	for _, value := range raw {
+		slug := utils.Slugify(value)
+		if slug == "" || len(slug) > utils.MaxSlugLength {
+			return nil, problem.NewFieldError("tags", "invalid", "invalid tag %q", value)
+		}
+		if !seen[slug] {
+			seen[slug] = true
+			tags = append(tags, slug)
+		}
+	}
+	return tags, nil
+}
+
+// queryTags reads ?tag= as repeated parameters, comma separated values or both.
+func queryTags(c *gin.Context) []string {
+	var tags []string
+	for _, value := range c.QueryArray("tag") {
+		for _, tag := range strings.Split(value, ",") {
+			if strings.TrimSpace(tag) != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// applyTagFilter narrows a book query to ?tag=... With the default
+// tag_mode=all a book needs every tag; with tag_mode=any one is enough.
+func applyTagFilter(c *gin.Context, q *queryBuilder) error {
+	raw := queryTags(c)
+	if len(raw) == 0 {
+		return nil
+	}
+
+	tags, err := normalizeTags(raw)
+	if err != nil {
+		return err
+	}
+
+	switch c.DefaultQuery("tag_mode", "all") {
+	case "all":
+		q.where(`id IN (
+			SELECT bt.book_id FROM book_tags bt JOIN tags t ON t.id = bt.tag_id
+			WHERE t.slug = ANY(%s) GROUP BY bt.book_id HAVING COUNT(*) = %s
+		)`, pq.Array(tags), len(tags))
+	case "any":
+		q.where(`id IN (
+			SELECT bt.book_id FROM book_tags bt JOIN tags t ON t.id = bt.tag_id
+			WHERE t.slug = ANY(%s)
+		)`, pq.Array(tags))
+	default:
+		return problem.NewFieldError("tag_mode", "oneof", "tag_mode must be all or any")
+	}
+	return nil
+}
+
+func loadBookTags(db dbExecutor, books []models.Book) error {
+	if len(books) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(books))
+	index := make(map[int][]int, len(books))
+	for i := range books {
+		ids[i] = books[i].ID
+		index[books[i].ID] = append(index[books[i].ID], i)
+		books[i].Tags = []string{}
+	}
+
+	rows, err := db.Query(`
+		SELECT bt.book_id, t.slug
+		FROM book_tags bt
+		JOIN tags t ON t.id = bt.tag_id
+		WHERE bt.book_id = ANY($1)
+		ORDER BY bt.book_id, t.slug
+	`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bookID int
+		var tag string
+		if err := rows.Scan(&bookID, &tag); err != nil {
+			return err
+		}
+		for _, i := range index[bookID] {
+			books[i].Tags = append(books[i].Tags, tag)
+		}
+	}
+	return rows.Err()
+}
+
+func GetTags(c *gin.Context) {
+	q := &queryBuilder{}
+	if prefix := utils.Slugify(c.Query("q")); prefix != "" {
+		q.where("t.slug LIKE %s", prefix+"%")
+	}
+
+	query := `
+		SELECT t.slug, COUNT(b.id)
+		FROM tags t
+		JOIN book_tags bt ON bt.tag_id = t.id
+		JOIN books b ON b.id = bt.book_id AND b.deleted_at IS NULL` + q.whereClause() + `
+		GROUP BY t.slug
+		ORDER BY COUNT(b.id) DESC, t.slug
+	`
+
+	rows, err := database.DbConnection.Query(query, q.args...)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to fetch tags")
+		return
+	}
+	defer rows.Close()
+
+	tags := []gin.H{}
+	for rows.Next() {
+		var slug string
+		var count int
+		if err := rows.Scan(&slug, &count); err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "Failed to parse tag")
+			return
+		}
+		tags = append(tags, gin.H{"tag": slug, "count": count})
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+func AddBookTags(c *gin.Context) {
+	id := c.Param("id")
+
+	var input struct {
+		Tags []string `json:"tags" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	tags, err := normalizeTags(input.Tags)
+	if err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	updatedBy, _ := c.Get("user")
+
+	tx, err := database.DbConnection.Begin()
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to tag book")
+		return
+	}
+	defer tx.Rollback()
+
+	existingBook, err := fetchBook(tx, id, true)
+	if err != nil || existingBook.DeletedAt.Valid {
+		problem.Respond(c, http.StatusNotFound, "Book not found")
+		return
+	}
+
+	// The no-op update makes RETURNING work for tags that already exist.
+	_, err = tx.Exec(`
+		WITH upserted AS (
+			INSERT INTO tags (slug, created_by)
+			SELECT UNNEST($1::text[]), $2
+			ON CONFLICT (slug) DO UPDATE SET slug = EXCLUDED.slug
+			RETURNING id
+		)
+		INSERT INTO book_tags (book_id, tag_id, created_by)
+		SELECT $3, id, $2 FROM upserted
+		ON CONFLICT DO NOTHING
+	`, pq.Array(tags), updatedBy, existingBook.ID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to tag book")
+		return
+	}
+
+	respondBookTags(c, tx, updatedBy, existingBook, "Failed to tag book")
+}
+
+func RemoveBookTag(c *gin.Context) {
+	id := c.Param("id")
+	slug := utils.Slugify(c.Param("tag"))
+	updatedBy, _ := c.Get("user")
+
+	tx, err := database.DbConnection.Begin()
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to untag book")
+		return
+	}
+	defer tx.Rollback()
+
+	existingBook, err := fetchBook(tx, id, true)
+	if err != nil || existingBook.DeletedAt.Valid {
+		problem.Respond(c, http.StatusNotFound, "Book not found")
+		return
+	}
+
+	result, err := tx.Exec("DELETE FROM book_tags WHERE book_id=$1 AND tag_id=(SELECT id FROM tags WHERE slug=$2)", existingBook.ID, slug)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to untag book")
+		return
+	}
+	if removed, _ := result.RowsAffected(); removed == 0 {
+		problem.Respond(c, http.StatusNotFound, "Book does not have this tag")
+		return
+	}
+
+	respondBookTags(c, tx, updatedBy, existingBook, "Failed to untag book")
+}
+
+// respondBookTags stamps and audits a tag change, commits it and returns the
+// book's tags as they are now.
+func respondBookTags(c *gin.Context, tx *sql.Tx, actor any, before *models.Book, failure string) {
+	if _, err := tx.Exec("UPDATE books SET modified_at=$1, modified_by=$2 WHERE id=$3", time.Now(), actor, before.ID); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, failure)
+		return
+	}
+
+	if err := recordBookAudit(tx, actor, models.AuditActionUpdate, before.ID, before); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to record audit log")
+		return
+	}
+
+	after, err := fetchBook(tx, before.ID, false)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, failure)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, failure)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"book_id": after.ID, "tags": after.Tags})
+}
@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/database"
+	"github.com/kandlagifari/go-books-apps/i18n"
+	"github.com/kandlagifari/go-books-apps/models"
+	"github.com/kandlagifari/go-books-apps/problem"
+	"github.com/kandlagifari/go-books-apps/utils"
+)
+
+// issueTokens creates an access token plus a new refresh token in the given
+// family and returns the id of the stored refresh token.
+func issueTokens(db dbExecutor, user *models.User, family string) (gin.H, int, error) {
+	accessToken, err := utils.GenerateToken(user.Username, user.Role, family)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	refreshToken, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var refreshID int
+	query := `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+	err = db.QueryRow(query, user.ID, family, utils.HashToken(refreshToken), time.Now().Add(utils.RefreshTokenTTL)).Scan(&refreshID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return gin.H{
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int(utils.AccessTokenTTL.Seconds()),
+	}, refreshID, nil
+}
+
+func revokeTokenFamily(db dbExecutor, family string) error {
+	_, err := db.Exec("UPDATE refresh_tokens SET revoked_at=NOW() WHERE family_id=$1 AND revoked_at IS NULL", family)
+	return err
+}
+
+func revokeUserTokens(db dbExecutor, userID int) error {
+	_, err := db.Exec("UPDATE refresh_tokens SET revoked_at=NOW() WHERE user_id=$1 AND revoked_at IS NULL", userID)
+	return err
+}
+
+func RefreshToken(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.FromError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	tx, err := database.DbConnection.Begin()
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer tx.Rollback()
+
+	var tokenID int
+	var family string
+	var expiresAt time.Time
+	var revokedAt sql.NullTime
+	var user models.User
+	query := `
+		SELECT rt.id, rt.family_id, rt.expires_at, rt.revoked_at, u.id, u.username, u.role
+		FROM refresh_tokens rt
+		JOIN users u ON u.id = rt.user_id
+		WHERE rt.token_hash = $1
+		FOR UPDATE OF rt
+	`
+	err = tx.QueryRow(query, utils.HashToken(input.RefreshToken)).Scan(&tokenID, &family, &expiresAt, &revokedAt, &user.ID, &user.Username, &user.Role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			problem.RespondCode(c, http.StatusUnauthorized, "token_invalid", "Invalid refresh token")
+			return
+		}
+		problem.Respond(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	// A refresh token is single-use. Seeing an already rotated one again means
+	// it was copied, so the whole family is revoked and the holder of the
+	// current token has to log in again as well.
+	if revokedAt.Valid {
+		if err := revokeTokenFamily(tx, family); err != nil || tx.Commit() != nil {
+			problem.Respond(c, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		problem.RespondCode(c, http.StatusUnauthorized, "token_reused", "Refresh token reuse detected")
+		return
+	}
+
+	if time.Now().After(expiresAt) {
+		problem.RespondCode(c, http.StatusUnauthorized, "token_expired", "Refresh token has expired")
+		return
+	}
+
+	tokens, newID, err := issueTokens(tx, &user, family)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Unable to generate token")
+		return
+	}
+
+	_, err = tx.Exec("UPDATE refresh_tokens SET revoked_at=NOW(), replaced_by=$1 WHERE id=$2", newID, tokenID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Unable to generate token")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Unable to generate token")
+		return
+	}
+
+	tokens["message"] = i18n.T(c, "Token refreshed successfully")
+	c.JSON(http.StatusOK, tokens)
+}
+
+func Logout(c *gin.Context) {
+	jti := c.GetString("token_id")
+	expiresAt := c.GetTime("token_expires_at")
+
+	tx, err := database.DbConnection.Begin()
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM revoked_tokens WHERE expires_at < NOW()"); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Unable to log out")
+		return
+	}
+
+	if jti != "" {
+		_, err := tx.Exec("INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING", jti, expiresAt)
+		if err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "Unable to log out")
+			return
+		}
+	}
+
+	if family := c.GetString("token_family"); family != "" {
+		if err := revokeTokenFamily(tx, family); err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "Unable to log out")
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Unable to log out")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": i18n.T(c, "Logout successful")})
+}
@@ -0,0 +1,355 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/database"
+	"github.com/kandlagifari/go-books-apps/i18n"
+	"github.com/kandlagifari/go-books-apps/models"
+	"github.com/kandlagifari/go-books-apps/problem"
+	"github.com/lib/pq"
+)
+
+func GetTrash(c *gin.Context) {
+	kind := c.Query("type")
+	if kind != "" && kind != "books" && kind != "categories" {
+		problem.Respond(c, http.StatusBadRequest, "type must be books or categories")
+		return
+	}
+
+	response := gin.H{}
+
+	if kind == "" || kind == "books" {
+		books, err := queryBooks("SELECT " + bookColumns + " FROM books WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id")
+		if err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "Failed to fetch books")
+			return
+		}
+		localizeBooks(c, books)
+		response["books"] = books
+	}
+
+	if kind == "" || kind == "categories" {
+		rows, err := database.DbConnection.Query("SELECT " + categoryColumns + " FROM categories WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id")
+		if err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "Failed to fetch categories")
+			return
+		}
+		defer rows.Close()
+
+		categories := []models.Category{}
+		for rows.Next() {
+			var category models.Category
+			if err := scanCategory(rows, &category); err != nil {
+				problem.Respond(c, http.StatusInternalServerError, "Failed to parse category")
+				return
+			}
+			categories = append(categories, category)
+		}
+		response["categories"] = categories
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// purgeBooks permanently deletes the given trashed books, logging each one.
+// It returns their covers, which the caller removes once the purge commits.
+func purgeBooks(db dbExecutor, actor any, ids []int) ([]bookCover, error) {
+	covers := make([]bookCover, 0, len(ids))
+	for _, id := range ids {
+		before, err := fetchBook(db, id, false)
+		if err != nil {
+			return nil, err
+		}
+		cover, err := currentCover(db, id)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := db.Exec("DELETE FROM books WHERE id=$1", id); err != nil {
+			return nil, err
+		}
+		if err := recordAudit(db, actor, models.AuditActionPurge, "book", id, before, nil); err != nil {
+			return nil, err
+		}
+		covers = append(covers, cover)
+	}
+	return covers, nil
+}
+
+func RestoreBook(c *gin.Context) {
+	id := c.Param("id")
+	updatedBy, _ := c.Get("user")
+
+	tx, err := database.DbConnection.Begin()
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to restore book")
+		return
+	}
+	defer tx.Rollback()
+
+	existingBook, err := fetchBook(tx, id, true)
+	if err != nil || !existingBook.DeletedAt.Valid {
+		problem.Respond(c, http.StatusNotFound, "Deleted book not found")
+		return
+	}
+
+	if !categoryExists(existingBook.CategoryID) {
+		problem.RespondCode(c, http.StatusConflict, "parent_deleted", "Restore the book's category first")
+		return
+	}
+
+	_, err = tx.Exec("UPDATE books SET deleted_at=NULL, deleted_by=NULL, modified_by=$1 WHERE id=$2", updatedBy, existingBook.ID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			problem.RespondCode(c, http.StatusConflict, "duplicate_isbn", "A book with the same ISBN already exists")
+			return
+		}
+		problem.Respond(c, http.StatusInternalServerError, "Failed to restore book")
+		return
+	}
+
+	if err := recordBookAudit(tx, updatedBy, models.AuditActionRestore, existingBook.ID, existingBook); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to record audit log")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to restore book")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": i18n.T(c, "Book restored successfully")})
+}
+
+// RestoreCategory also restores the books that were trashed together with the
+// category by a cascading delete, but not books that were deleted on their own.
+func RestoreCategory(c *gin.Context) {
+	id := c.Param("id")
+	updatedBy, _ := c.Get("user")
+
+	tx, err := database.DbConnection.Begin()
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to restore category")
+		return
+	}
+	defer tx.Rollback()
+
+	existingCategory, err := fetchCategory(tx, id, true)
+	if err != nil || !existingCategory.DeletedAt.Valid {
+		problem.Respond(c, http.StatusNotFound, "Deleted category not found")
+		return
+	}
+
+	if existingCategory.ParentID != nil {
+		if err := lockParentCategory(tx, *existingCategory.ParentID); err != nil {
+			if err == errInvalidParent {
+				problem.RespondCode(c, http.StatusConflict, "parent_deleted", "Restore the parent category first")
+				return
+			}
+			problem.Respond(c, http.StatusInternalServerError, "Failed to restore category")
+			return
+		}
+	}
+
+	_, err = tx.Exec("UPDATE categories SET deleted_at=NULL, deleted_by=NULL, modified_by=$1 WHERE id=$2", updatedBy, existingCategory.ID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			problem.RespondCode(c, http.StatusConflict, "duplicate_name", "A category with the same name already exists")
+			return
+		}
+		problem.Respond(c, http.StatusInternalServerError, "Failed to restore category")
+		return
+	}
+
+	if err := recordCategoryAudit(tx, updatedBy, models.AuditActionRestore, existingCategory.ID, existingCategory); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to record audit log")
+		return
+	}
+
+	bookIDs, err := lockIDs(tx, "SELECT id FROM books WHERE category_id=$1 AND deleted_at=$2 ORDER BY id FOR UPDATE", existingCategory.ID, existingCategory.DeletedAt.Time)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to restore category books")
+		return
+	}
+
+	for _, bookID := range bookIDs {
+		before, err := fetchBook(tx, bookID, false)
+		if err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "Failed to restore category books")
+			return
+		}
+
+		_, err = tx.Exec("UPDATE books SET deleted_at=NULL, deleted_by=NULL, modified_by=$1 WHERE id=$2", updatedBy, bookID)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				problem.RespondCode(c, http.StatusConflict, "duplicate_isbn", "A book in this category has the same ISBN as an existing book")
+				return
+			}
+			problem.Respond(c, http.StatusInternalServerError, "Failed to restore category books")
+			return
+		}
+
+		if err := recordBookAudit(tx, updatedBy, models.AuditActionRestore, bookID, before); err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "Failed to record audit log")
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to restore category")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": i18n.T(c, "Category restored successfully")})
+}
+
+func PurgeBook(c *gin.Context) {
+	id := c.Param("id")
+	actor, _ := c.Get("user")
+
+	tx, err := database.DbConnection.Begin()
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to purge book")
+		return
+	}
+	defer tx.Rollback()
+
+	existingBook, err := fetchBook(tx, id, true)
+	if err != nil || !existingBook.DeletedAt.Valid {
+		problem.Respond(c, http.StatusNotFound, "Deleted book not found")
+		return
+	}
+
+	covers, err := purgeBooks(tx, actor, []int{existingBook.ID})
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to purge book")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to purge book")
+		return
+	}
+	removeBookCovers(covers)
+
+	c.JSON(http.StatusOK, gin.H{"message": i18n.T(c, "Book purged successfully")})
+}
+
+// PurgeCategory permanently removes a trashed category together with its
+// trashed books. It refuses while live books still point at the category.
+func PurgeCategory(c *gin.Context) {
+	id := c.Param("id")
+	actor, _ := c.Get("user")
+
+	tx, err := database.DbConnection.Begin()
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to purge category")
+		return
+	}
+	defer tx.Rollback()
+
+	existingCategory, err := fetchCategory(tx, id, true)
+	if err != nil || !existingCategory.DeletedAt.Valid {
+		problem.Respond(c, http.StatusNotFound, "Deleted category not found")
+		return
+	}
+
+	var hasLiveBooks bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM books WHERE category_id=$1 AND deleted_at IS NULL)", existingCategory.ID).Scan(&hasLiveBooks)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to purge category")
+		return
+	}
+	if hasLiveBooks {
+		problem.RespondCode(c, http.StatusConflict, "category_not_empty", "Category still has books that are not deleted")
+		return
+	}
+
+	var covers []bookCover
+	bookIDs, err := lockIDs(tx, "SELECT id FROM books WHERE category_id=$1 ORDER BY id FOR UPDATE", existingCategory.ID)
+	if err == nil {
+		covers, err = purgeBooks(tx, actor, bookIDs)
+	}
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to purge category books")
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM categories WHERE id=$1", existingCategory.ID); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to purge category")
+		return
+	}
+
+	if err := recordAudit(tx, actor, models.AuditActionPurge, "category", existingCategory.ID, existingCategory, nil); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to record audit log")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to purge category")
+		return
+	}
+	removeBookCovers(covers)
+
+	c.JSON(http.StatusOK, gin.H{"message": i18n.T(c, "Category purged successfully")})
+}
+
+func EmptyTrash(c *gin.Context) {
+	actor, _ := c.Get("user")
+
+	tx, err := database.DbConnection.Begin()
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to empty trash")
+		return
+	}
+	defer tx.Rollback()
+
+	var covers []bookCover
+	bookIDs, err := lockIDs(tx, "SELECT id FROM books WHERE deleted_at IS NOT NULL ORDER BY id FOR UPDATE")
+	if err == nil {
+		covers, err = purgeBooks(tx, actor, bookIDs)
+	}
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to empty trash")
+		return
+	}
+
+	categoryIDs, err := lockIDs(tx, `
+		SELECT id FROM categories c
+		WHERE deleted_at IS NOT NULL
+			AND NOT EXISTS (SELECT 1 FROM books b WHERE b.category_id = c.id)
+		ORDER BY id
+		FOR UPDATE
+	`)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to empty trash")
+		return
+	}
+
+	for _, categoryID := range categoryIDs {
+		before, err := fetchCategory(tx, categoryID, false)
+		if err == nil {
+			_, err = tx.Exec("DELETE FROM categories WHERE id=$1", categoryID)
+		}
+		if err == nil {
+			err = recordAudit(tx, actor, models.AuditActionPurge, "category", categoryID, before, nil)
+		}
+		if err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "Failed to empty trash")
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to empty trash")
+		return
+	}
+	removeBookCovers(covers)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":           i18n.T(c, "Trash emptied successfully"),
+		"purged_books":      len(bookIDs),
+		"purged_categories": len(categoryIDs),
+	})
+}
@@ -0,0 +1,18 @@
+-- +migrate Up
+-- +migrate StatementBegin
+
+CREATE TABLE audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor VARCHAR(255),
+    action VARCHAR(32) NOT NULL,
+    entity VARCHAR(32) NOT NULL,
+    entity_id INT,
+    changes JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX audit_log_entity_idx ON audit_log (entity, entity_id, created_at);
+CREATE INDEX audit_log_actor_idx ON audit_log (actor, created_at);
+CREATE INDEX audit_log_created_at_idx ON audit_log (created_at);
+
+-- +migrate StatementEnd
@@ -0,0 +1,15 @@
+-- +migrate Up
+-- +migrate StatementBegin
+
+ALTER TABLE books
+ADD COLUMN isbn10 VARCHAR(10),
+ADD COLUMN isbn13 VARCHAR(13);
+
+-- The ISBN-13 identifies an edition, so it replaces the title as the unique
+-- key: different editions may now share a title.
+CREATE UNIQUE INDEX books_isbn13_unique_idx ON books (isbn13) WHERE deleted_at IS NULL;
+
+DROP INDEX books_title_unique_idx;
+CREATE INDEX books_title_idx ON books (title) WHERE deleted_at IS NULL;
+
+-- +migrate StatementEnd
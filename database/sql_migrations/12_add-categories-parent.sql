@@ -0,0 +1,14 @@
+-- +migrate Up
+-- +migrate StatementBegin
+
+-- A category is only trashed once it has no live subcategories, and a
+-- subcategory cannot be restored under a trashed parent, so by the time a
+-- parent is purged its remaining children are in the trash too and simply
+-- become roots.
+ALTER TABLE categories
+ADD COLUMN parent_id INT REFERENCES categories (id) ON DELETE SET NULL,
+ADD CONSTRAINT categories_parent_not_self CHECK (parent_id <> id);
+
+CREATE INDEX categories_parent_id_idx ON categories (parent_id);
+
+-- +migrate StatementEnd
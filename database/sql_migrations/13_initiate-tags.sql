@@ -0,0 +1,21 @@
+-- +migrate Up
+-- +migrate StatementBegin
+
+CREATE TABLE tags (
+    id SERIAL PRIMARY KEY,
+    slug VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    created_by VARCHAR(255)
+);
+
+CREATE TABLE book_tags (
+    book_id INT NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    tag_id INT NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    created_by VARCHAR(255),
+    PRIMARY KEY (book_id, tag_id)
+);
+
+CREATE INDEX book_tags_tag_id_idx ON book_tags (tag_id);
+
+-- +migrate StatementEnd
@@ -0,0 +1,22 @@
+-- +migrate Up
+-- +migrate StatementBegin
+
+-- version backs the ETag of books and categories. The trigger bumps it on
+-- every update so no write path can forget to.
+ALTER TABLE books ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE categories ADD COLUMN version INT NOT NULL DEFAULT 1;
+
+CREATE FUNCTION bump_version() RETURNS trigger AS $$
+BEGIN
+    NEW.version := OLD.version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER books_bump_version BEFORE UPDATE ON books
+FOR EACH ROW EXECUTE FUNCTION bump_version();
+
+CREATE TRIGGER categories_bump_version BEFORE UPDATE ON categories
+FOR EACH ROW EXECUTE FUNCTION bump_version();
+
+-- +migrate StatementEnd
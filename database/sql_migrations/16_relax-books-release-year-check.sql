@@ -0,0 +1,10 @@
+-- +migrate Up
+-- +migrate StatementBegin
+
+-- The allowed release years are configured in the application (see the rules
+-- package) and move with the calendar, so the database only keeps a sanity
+-- bound instead of the old fixed 1980..2024 window.
+ALTER TABLE books DROP CONSTRAINT IF EXISTS books_release_year_check;
+ALTER TABLE books ADD CONSTRAINT books_release_year_check CHECK (release_year BETWEEN 1 AND 9999);
+
+-- +migrate StatementEnd
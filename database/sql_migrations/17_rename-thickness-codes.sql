@@ -0,0 +1,9 @@
+-- +migrate Up
+-- +migrate StatementBegin
+
+-- Thickness is now stored as a language-neutral code and translated when a
+-- book is served, so the Indonesian names of the default buckets are renamed.
+UPDATE books SET thickness = 'thin' WHERE thickness = 'tipis';
+UPDATE books SET thickness = 'thick' WHERE thickness = 'tebal';
+
+-- +migrate StatementEnd
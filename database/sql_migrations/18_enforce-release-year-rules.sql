@@ -0,0 +1,44 @@
+-- +migrate Up
+-- +migrate StatementBegin
+
+-- The release year rules are configured in the application, which writes
+-- them here on start-up, so that rows written outside the API are held to the
+-- same bounds. A NULL max_release_year follows the calendar. The table has a
+-- single row.
+CREATE TABLE book_rules (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    min_release_year INT NOT NULL,
+    max_release_year INT,
+    release_years_ahead INT NOT NULL
+);
+
+INSERT INTO book_rules (min_release_year, max_release_year, release_years_ahead) VALUES (1980, NULL, 1);
+
+CREATE FUNCTION check_release_year() RETURNS trigger AS $$
+DECLARE
+    settings book_rules%ROWTYPE;
+    latest INT;
+BEGIN
+    SELECT * INTO settings FROM book_rules;
+    IF NOT FOUND THEN
+        RETURN NEW;
+    END IF;
+
+    latest := COALESCE(settings.max_release_year, EXTRACT(YEAR FROM CURRENT_DATE)::INT + settings.release_years_ahead);
+    IF NEW.release_year < settings.min_release_year OR NEW.release_year > latest THEN
+        RAISE EXCEPTION 'release year % is outside % to %', NEW.release_year, settings.min_release_year, latest
+            USING ERRCODE = 'check_violation', CONSTRAINT = 'books_release_year_check';
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Rows whose year is left alone keep it even when the rules have since
+-- moved, so unrelated updates of old books do not fail.
+CREATE TRIGGER books_check_release_year_insert BEFORE INSERT ON books
+FOR EACH ROW EXECUTE FUNCTION check_release_year();
+
+CREATE TRIGGER books_check_release_year_update BEFORE UPDATE OF release_year ON books
+FOR EACH ROW WHEN (NEW.release_year IS DISTINCT FROM OLD.release_year) EXECUTE FUNCTION check_release_year();
+
+-- +migrate StatementEnd
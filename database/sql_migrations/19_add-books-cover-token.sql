@@ -0,0 +1,10 @@
+-- +migrate Up
+-- +migrate StatementBegin
+
+-- Every upload stores its cover files under a new token, and the book only
+-- points at them once the upload commits, so a failed upload never replaces
+-- the cover that is being served. Covers uploaded before this column existed
+-- keep their old location, which a NULL token stands for.
+ALTER TABLE books ADD COLUMN cover_token TEXT;
+
+-- +migrate StatementEnd
@@ -0,0 +1,12 @@
+-- +migrate Up
+-- +migrate StatementBegin
+
+ALTER TABLE books
+ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple'::regconfig, coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('simple'::regconfig, coalesce(description, '')), 'B')
+) STORED;
+
+CREATE INDEX books_search_vector_idx ON books USING GIN (search_vector);
+
+-- +migrate StatementEnd
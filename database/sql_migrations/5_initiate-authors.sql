@@ -0,0 +1,29 @@
+-- +migrate Up
+-- +migrate StatementBegin
+
+CREATE TABLE authors (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    bio TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    created_by VARCHAR(255),
+    modified_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    modified_by VARCHAR(255)
+);
+
+CREATE TRIGGER set_modified_at
+BEFORE UPDATE ON authors
+FOR EACH ROW
+EXECUTE FUNCTION update_modified_at_column();
+
+CREATE TABLE book_authors (
+    book_id INT NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    author_id INT NOT NULL REFERENCES authors(id) ON DELETE RESTRICT,
+    role VARCHAR(20) NOT NULL DEFAULT 'author' CHECK (role IN ('author', 'editor', 'translator', 'illustrator')),
+    position INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (book_id, author_id, role)
+);
+
+CREATE INDEX book_authors_author_id_idx ON book_authors (author_id);
+
+-- +migrate StatementEnd
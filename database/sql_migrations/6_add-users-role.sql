@@ -0,0 +1,12 @@
+-- +migrate Up
+-- +migrate StatementBegin
+
+ALTER TABLE users
+ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'reader' CHECK (role IN ('admin', 'editor', 'reader'));
+
+-- Accounts created before roles existed could already write, so keep them as
+-- editors and hand admin to the oldest account.
+UPDATE users SET role = 'editor';
+UPDATE users SET role = 'admin' WHERE id = (SELECT MIN(id) FROM users);
+
+-- +migrate StatementEnd
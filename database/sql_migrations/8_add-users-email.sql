@@ -0,0 +1,22 @@
+-- +migrate Up
+-- +migrate StatementBegin
+
+ALTER TABLE users
+ADD COLUMN email VARCHAR(255),
+ADD COLUMN email_verified_at TIMESTAMP;
+
+CREATE UNIQUE INDEX users_email_unique_idx ON users (LOWER(email));
+
+CREATE TABLE user_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(32) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX user_tokens_user_id_idx ON user_tokens (user_id, purpose);
+
+-- +migrate StatementEnd
@@ -0,0 +1,22 @@
+-- +migrate Up
+-- +migrate StatementBegin
+
+ALTER TABLE books
+ADD COLUMN deleted_at TIMESTAMP,
+ADD COLUMN deleted_by VARCHAR(255);
+
+ALTER TABLE categories
+ADD COLUMN deleted_at TIMESTAMP,
+ADD COLUMN deleted_by VARCHAR(255);
+
+-- Names only have to be unique among rows that have not been deleted, so a
+-- trashed book or category does not block re-creating it.
+ALTER TABLE books DROP CONSTRAINT books_title_key;
+CREATE UNIQUE INDEX books_title_unique_idx ON books (title) WHERE deleted_at IS NULL;
+
+ALTER TABLE categories DROP CONSTRAINT categories_name_key;
+CREATE UNIQUE INDEX categories_name_unique_idx ON categories (name) WHERE deleted_at IS NULL;
+
+CREATE INDEX books_category_id_idx ON books (category_id);
+
+-- +migrate StatementEnd
@@ -0,0 +1,229 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultLanguage is used when the client asks for nothing we have. Messages
+// are written in it in the code, so its catalog only needs entries for keys
+// that are not plain English text, such as thickness labels.
+const DefaultLanguage = "en"
+
+// contextKey is where the Language middleware stores the chosen language.
+const contextKey = "lang"
+
+//go:embed locales/*.json
+var builtinLocales embed.FS
+
+// Catalog maps an English message, or a key such as "thickness.thin", to its
+// translation. Messages with arguments use the same verbs as fmt.
+type Catalog map[string]string
+
+// Bundle holds the catalogs of every supported language.
+type Bundle struct {
+	catalogs map[string]Catalog
+}
+
+type Config struct {
+	// Dir holds extra <language>.json catalogs. A file for a language that is
+	// built in replaces entries of the built-in catalog.
+	Dir string
+}
+
+var Default = mustLoadBuiltin()
+
+func mustLoadBuiltin() *Bundle {
+	b := &Bundle{catalogs: map[string]Catalog{}}
+	if err := b.loadDir(builtinLocales, "locales"); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func New(cfg Config) (*Bundle, error) {
+	b := mustLoadBuiltin()
+	if cfg.Dir != "" {
+		if err := b.loadDir(os.DirFS(cfg.Dir), "."); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (b *Bundle) loadDir(fsys fs.FS, dir string) error {
+	paths, err := fs.Glob(fsys, filepath.ToSlash(filepath.Join(dir, "*.json")))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		var catalog Catalog
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			return fmt.Errorf("catalog %s: %w", path, err)
+		}
+
+		lang := strings.ToLower(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if b.catalogs[lang] == nil {
+			b.catalogs[lang] = Catalog{}
+		}
+		for key, value := range catalog {
+			b.catalogs[lang][key] = value
+		}
+	}
+
+	if b.catalogs[DefaultLanguage] == nil {
+		b.catalogs[DefaultLanguage] = Catalog{}
+	}
+	return nil
+}
+
+// Languages lists the supported languages in alphabetical order.
+func (b *Bundle) Languages() []string {
+	languages := make([]string, 0, len(b.catalogs))
+	for lang := range b.catalogs {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Lookup returns the translation of key, falling back to the default
+// language. The boolean reports whether any catalog had it.
+func (b *Bundle) Lookup(lang, key string) (string, bool) {
+	if value, ok := b.catalogs[lang][key]; ok {
+		return value, true
+	}
+	value, ok := b.catalogs[DefaultLanguage][key]
+	return value, ok
+}
+
+// Translate translates format and fills in args. Untranslated messages are
+// returned in English.
+func (b *Bundle) Translate(lang, format string, args ...any) string {
+	if value, ok := b.Lookup(lang, format); ok {
+		format = value
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Match picks the language for a request: override when it is supported,
+// otherwise the best supported entry of an Accept-Language header.
+func (b *Bundle) Match(override, acceptLanguage string) string {
+	if lang := strings.ToLower(strings.TrimSpace(override)); b.catalogs[lang] != nil {
+		return lang
+	}
+
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if tag != "" && q > 0 {
+			tags = append(tags, weighted{strings.ToLower(tag), q})
+		}
+	}
+	slices.SortStableFunc(tags, func(a, b weighted) int {
+		switch {
+		case a.q > b.q:
+			return -1
+		case a.q < b.q:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	for _, t := range tags {
+		if t.tag == "*" {
+			return DefaultLanguage
+		}
+		if b.catalogs[t.tag] != nil {
+			return t.tag
+		}
+		if base, _, found := strings.Cut(t.tag, "-"); found && b.catalogs[base] != nil {
+			return base
+		}
+	}
+	return DefaultLanguage
+}
+
+// SetLanguage records the language chosen for the request.
+func SetLanguage(c *gin.Context, lang string) {
+	c.Set(contextKey, lang)
+}
+
+// Language returns the language chosen for the request.
+func Language(c *gin.Context) string {
+	if lang := c.GetString(contextKey); lang != "" {
+		return lang
+	}
+	return DefaultLanguage
+}
+
+// T translates a message into the request's language.
+func T(c *gin.Context, format string, args ...any) string {
+	return Default.Translate(Language(c), format, args...)
+}
+
+// Message is an error whose text is translated when it is shown rather than
+// when it is created, because the language is not known at that point.
+type Message struct {
+	Format string
+	Args   []any
+}
+
+func Errorf(format string, args ...any) error {
+	return &Message{Format: format, Args: args}
+}
+
+func (m *Message) Error() string {
+	return fmt.Sprintf(m.Format, m.Args...)
+}
+
+// Error translates err for the request. Errors that are not a Message are
+// looked up by their full text.
+func Error(c *gin.Context, err error) string {
+	var message *Message
+	if errors.As(err, &message) && message == err {
+		return T(c, message.Format, message.Args...)
+	}
+	return T(c, err.Error())
+}
+
+// ThicknessLabel is the display name of a thickness code. Codes without a
+// label, such as custom buckets, are shown as they are.
+func ThicknessLabel(c *gin.Context, code string) string {
+	if label, ok := Default.Lookup(Language(c), "thickness."+code); ok {
+		return label
+	}
+	return code
+}
@@ -0,0 +1,104 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DefaultTTL is how long a stored response is replayed when no window is
+// configured.
+const DefaultTTL = 24 * time.Hour
+
+// pendingTimeout bounds how long a key stays reserved by a request that never
+// completed, for example because the process died while handling it. Requests
+// that are still running keep their reservation alive with KeepAlive.
+const pendingTimeout = 5 * time.Minute
+
+// Response is a stored response that is replayed for repeated keys.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Record is what a store knows about a key. Response is nil while the first
+// request with the key is still being handled.
+type Record struct {
+	Fingerprint string
+	Response    *Response
+}
+
+type Store interface {
+	// Reserve claims key for a request with the given fingerprint. It returns
+	// nil when the caller now owns the key, or the existing record otherwise.
+	Reserve(ctx context.Context, key, fingerprint string) (*Record, error)
+	// Complete stores the response for a reserved key.
+	Complete(ctx context.Context, key string, response *Response) error
+	// Release drops a reservation so the request can be retried.
+	Release(ctx context.Context, key string) error
+	// Extend pushes back the expiry of a reservation that has not completed.
+	Extend(ctx context.Context, key string) error
+}
+
+type Config struct {
+	Driver string
+	TTL    time.Duration
+	DB     *sql.DB
+}
+
+var Default Store = NewMemoryStore(DefaultTTL)
+
+func New(cfg Config) (Store, error) {
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	switch cfg.Driver {
+	case "", "postgres":
+		if cfg.DB == nil {
+			return nil, fmt.Errorf("idempotency store %q needs a database", "postgres")
+		}
+		return &PostgresStore{DB: cfg.DB, TTL: ttl}, nil
+	case "memory":
+		return NewMemoryStore(ttl), nil
+	default:
+		return nil, fmt.Errorf("unknown idempotency store %q", cfg.Driver)
+	}
+}
+
+// ScopedKey namespaces a client supplied key by user and endpoint, so two
+// users or two endpoints never share a stored response.
+func ScopedKey(user, method, path, key string) string {
+	sum := sha256.Sum256([]byte(user + "\x00" + method + " " + path + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+func pendingTTL(ttl time.Duration) time.Duration {
+	return min(ttl, pendingTimeout)
+}
+
+// KeepAlive extends the reservation of key until stop is called, so a request
+// that runs longer than pendingTimeout, such as a large import, does not lose
+// its key to a retry while it is still being handled.
+func KeepAlive(ctx context.Context, store Store, key string) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(pendingTimeout / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				store.Extend(ctx, key)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,80 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	record  Record
+	expires time.Time
+}
+
+// MemoryStore keeps keys in process memory. It suits a single instance and
+// tests; keys are lost on restart.
+type MemoryStore struct {
+	TTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{TTL: ttl, entries: map[string]*memoryEntry{}}
+}
+
+func (s *MemoryStore) Reserve(ctx context.Context, key, fingerprint string) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	// Sweep expired entries now and then so the map cannot grow forever.
+	if len(s.entries) >= 1024 {
+		for k, entry := range s.entries {
+			if now.After(entry.expires) {
+				delete(s.entries, k)
+			}
+		}
+	}
+
+	if entry, ok := s.entries[key]; ok && !now.After(entry.expires) {
+		record := entry.record
+		return &record, nil
+	}
+
+	s.entries[key] = &memoryEntry{
+		record:  Record{Fingerprint: fingerprint},
+		expires: now.Add(pendingTTL(s.TTL)),
+	}
+	return nil, nil
+}
+
+func (s *MemoryStore) Complete(ctx context.Context, key string, response *Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[key]; ok {
+		entry.record.Response = response
+		entry.expires = time.Now().Add(s.TTL)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryStore) Extend(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[key]; ok && entry.record.Response == nil {
+		entry.expires = time.Now().Add(pendingTTL(s.TTL))
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// PostgresStore keeps keys in the idempotency_keys table, so responses are
+// replayed across restarts and by every instance sharing the database.
+type PostgresStore struct {
+	DB  *sql.DB
+	TTL time.Duration
+}
+
+func (s *PostgresStore) Reserve(ctx context.Context, key, fingerprint string) (*Record, error) {
+	if _, err := s.DB.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at < NOW()"); err != nil {
+		return nil, err
+	}
+
+	// The row can expire or be released between the insert and the select,
+	// in which case the insert is simply tried again.
+	for {
+		result, err := s.DB.ExecContext(ctx, `
+			INSERT INTO idempotency_keys (key, fingerprint, expires_at)
+			VALUES ($1, $2, NOW() + make_interval(secs => $3))
+			ON CONFLICT (key) DO NOTHING
+		`, key, fingerprint, pendingTTL(s.TTL).Seconds())
+		if err != nil {
+			return nil, err
+		}
+		if inserted, _ := result.RowsAffected(); inserted == 1 {
+			return nil, nil
+		}
+
+		var record Record
+		var status sql.NullInt64
+		var header []byte
+		var body []byte
+		err = s.DB.QueryRowContext(ctx, `
+			SELECT fingerprint, status_code, headers, body
+			FROM idempotency_keys
+			WHERE key = $1
+		`, key).Scan(&record.Fingerprint, &status, &header, &body)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if status.Valid {
+			record.Response = &Response{Status: int(status.Int64), Body: body}
+			if err := json.Unmarshal(header, &record.Response.Header); err != nil {
+				return nil, err
+			}
+		}
+		return &record, nil
+	}
+}
+
+func (s *PostgresStore) Complete(ctx context.Context, key string, response *Response) error {
+	header, err := json.Marshal(response.Header)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.DB.ExecContext(ctx, `
+		UPDATE idempotency_keys
+		SET status_code = $1, headers = $2, body = $3, completed_at = NOW(), expires_at = NOW() + make_interval(secs => $4)
+		WHERE key = $5
+	`, response.Status, header, response.Body, s.TTL.Seconds(), key)
+	return err
+}
+
+func (s *PostgresStore) Release(ctx context.Context, key string) error {
+	_, err := s.DB.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE key = $1 AND status_code IS NULL", key)
+	return err
+}
+
+func (s *PostgresStore) Extend(ctx context.Context, key string) error {
+	_, err := s.DB.ExecContext(ctx, `
+		UPDATE idempotency_keys
+		SET expires_at = NOW() + make_interval(secs => $1)
+		WHERE key = $2 AND status_code IS NULL
+	`, pendingTTL(s.TTL).Seconds(), key)
+	return err
+}
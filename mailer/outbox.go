@@ -0,0 +1,27 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// OutboxMailer writes every message as an .eml file instead of delivering it,
+// which is what local development and tests want.
+type OutboxMailer struct {
+	Dir  string
+	From string
+}
+
+var outboxSequence atomic.Uint64
+
+func (m *OutboxMailer) Send(msg Message) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%04d.eml", time.Now().Format("20060102T150405.000000000"), outboxSequence.Add(1))
+	return os.WriteFile(filepath.Join(m.Dir, name), render(m.From, msg), 0o644)
+}
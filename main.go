@@ -1,14 +1,33 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
+	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
+	"github.com/kandlagifari/go-books-apps/commands"
+	"github.com/kandlagifari/go-books-apps/config"
+	"github.com/kandlagifari/go-books-apps/controllers"
 	"github.com/kandlagifari/go-books-apps/database"
+	"github.com/kandlagifari/go-books-apps/i18n"
+	"github.com/kandlagifari/go-books-apps/idempotency"
+	"github.com/kandlagifari/go-books-apps/mailer"
+	"github.com/kandlagifari/go-books-apps/metadata"
+	"github.com/kandlagifari/go-books-apps/middleware"
+	"github.com/kandlagifari/go-books-apps/problem"
 	"github.com/kandlagifari/go-books-apps/routes"
+	"github.com/kandlagifari/go-books-apps/rules"
+	"github.com/kandlagifari/go-books-apps/storage"
+	"github.com/kandlagifari/go-books-apps/utils"
 
 	_ "github.com/lib/pq"
 )
@@ -19,21 +38,37 @@ var (
 )
 
 func main() {
-	err = godotenv.Load("config/.env")
+	cfg, err := config.Load(os.Args[1:])
+	if cfg != nil && cfg.PrintConfig {
+		if printErr := cfg.Print(os.Stdout); printErr != nil {
+			panic(printErr)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		panic("Error loading .env file")
+		panic(err)
 	}
 
-	psqlInfo := fmt.Sprintf(`host=%s port=%s user=%s password=%s dbname=%s sslmode=disable`,
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"),
-	)
+	utils.SetJWTKey(cfg.Auth.JWTSecret)
+	utils.AccessTokenTTL = cfg.Auth.AccessTokenTTL
+	utils.RefreshTokenTTL = cfg.Auth.RefreshTokenTTL
+
+	DB, err = sql.Open("postgres", cfg.Database.DSN())
+	if err != nil {
+		panic(err)
+	}
+	DB.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	DB.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	DB.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
+	DB.SetConnMaxIdleTime(cfg.Database.ConnMaxIdleTime)
 
-	DB, err = sql.Open("postgres", psqlInfo)
-	defer DB.Close()
 	err = DB.Ping()
 	if err != nil {
 		panic(err)
@@ -41,14 +76,146 @@ func main() {
 
 	database.DBMigrate(DB)
 
+	mailer.Default, err = mailer.New(mailer.Config{
+		Driver:       cfg.Mail.Driver,
+		From:         cfg.Mail.From,
+		SMTPHost:     cfg.Mail.SMTPHost,
+		SMTPPort:     cfg.Mail.SMTPPort,
+		SMTPUsername: cfg.Mail.SMTPUsername,
+		SMTPPassword: cfg.Mail.SMTPPassword,
+		OutboxDir:    cfg.Mail.OutboxDir,
+	})
+	if err != nil {
+		panic(err)
+	}
+	storage.Default, err = storage.New(storage.Config{
+		Driver:   cfg.Storage.Driver,
+		LocalDir: cfg.Storage.Dir,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	metadata.Default, err = metadata.New(metadata.Config{
+		Providers:      cfg.Metadata.Providers,
+		OpenLibraryURL: cfg.Metadata.OpenLibraryURL,
+		FixturePath:    cfg.Metadata.FixturePath,
+		CacheTTL:       cfg.Metadata.CacheTTL,
+		CacheSize:      cfg.Metadata.CacheSize,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	idempotency.Default, err = idempotency.New(idempotency.Config{
+		Driver: cfg.Idempotency.Store,
+		TTL:    cfg.Idempotency.TTL,
+		DB:     DB,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	rules.Default, err = rules.New(rules.Config{
+		MinReleaseYear:    cfg.Rules.MinReleaseYear,
+		MaxReleaseYear:    cfg.Rules.MaxReleaseYear,
+		ReleaseYearsAhead: cfg.Rules.ReleaseYearsAhead,
+		ThicknessBuckets:  cfg.Rules.ThicknessBuckets,
+	})
+	if err != nil {
+		panic(err)
+	}
+	if err := rules.Default.Save(DB); err != nil {
+		panic(err)
+	}
+
+	i18n.Default, err = i18n.New(i18n.Config{
+		Dir: cfg.I18n.Dir,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	controllers.RequireIfMatch = cfg.Server.RequireIfMatch
+	controllers.AppBaseURL = cfg.Server.BaseURL
+	controllers.FrontendURL = cfg.Server.FrontendURL
+	middleware.StreamTimeout = cfg.Server.StreamTimeout
+	middleware.IdempotentBodyLimit = int64(cfg.Idempotency.MaxBodySize)
+
+	if len(cfg.Args) > 0 {
+		defer DB.Close()
+		if err := commands.Run(cfg.Args); err != nil {
+			panic(err)
+		}
+		return
+	}
+
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
+	router.Use(gin.Recovery(), middleware.Language)
 
 	routes.RegisterAuthRoutes(router)
 	routes.RegisterCategoryRoutes(router)
 	routes.RegisterBookRoutes(router)
+	routes.RegisterAuthorRoutes(router)
+	routes.RegisterTagRoutes(router)
+	routes.RegisterTrashRoutes(router)
+	routes.RegisterAuditRoutes(router)
+	routes.RegisterRuleRoutes(router)
+	routes.RegisterHealthRoutes(router)
+
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(func(c *gin.Context) {
+		problem.Respond(c, http.StatusNotFound, "Route not found")
+	})
+	router.NoMethod(func(c *gin.Context) {
+		problem.Respond(c, http.StatusMethodNotAllowed, "Method not allowed")
+	})
 
-	router.Use(gin.Recovery())
+	server := &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           router,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	controllers.StartPasswordResets()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+	log.Println("Listening on", cfg.Server.Addr)
+
+	select {
+	case err := <-serverErr:
+		panic(err)
+	case <-ctx.Done():
+	}
+	// A second signal kills the process instead of waiting for the drain.
+	stop()
+
+	log.Println("Shutting down")
+	controllers.BeginShutdown()
+	time.Sleep(cfg.Server.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("Requests did not finish in time:", err)
+		server.Close()
+	}
+	if err := controllers.StopPasswordResets(shutdownCtx); err != nil {
+		log.Println("Queued password resets were not sent:", err)
+	}
 
-	router.Run(":4321")
+	if err := DB.Close(); err != nil {
+		log.Println("Closing the database failed:", err)
+	}
+	log.Println("Server stopped")
 }
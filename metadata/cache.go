@@ -0,0 +1,74 @@
+package metadata
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize is how many lookups are kept when no size is configured.
+const DefaultCacheSize = 10000
+
+type cacheEntry struct {
+	key     string
+	result  *Result
+	expires time.Time
+}
+
+// cache keeps lookups for a TTL and at most size of them, evicting the least
+// recently used first. A nil result records a miss.
+type cache struct {
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	order   *list.List // front is the most recently used
+	entries map[string]*list.Element
+}
+
+func newCache(ttl time.Duration, size int) *cache {
+	return &cache{ttl: ttl, size: size, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (c *cache) get(key string) (*Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry.result, true
+}
+
+// set stores result for ttl, or for the cache's own TTL when ttl is 0. A
+// shorter ttl than the cache's is used for results worth retrying soon.
+func (c *cache) set(key string, result *Result, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ttl <= 0 || ttl > c.ttl {
+		ttl = c.ttl
+	}
+	entry := &cacheEntry{key: key, result: result, expires: time.Now().Add(ttl)}
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
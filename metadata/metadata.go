@@ -0,0 +1,152 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrNotFound = errors.New("no metadata found")
+
+// Record is what a provider knows about an edition. Empty fields mean the
+// provider had nothing to say about them.
+type Record struct {
+	ISBN13      string   `json:"isbn13"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	ImageURL    string   `json:"image_url"`
+	ReleaseYear int      `json:"release_year"`
+	TotalPage   int      `json:"total_page"`
+	Authors     []string `json:"authors"`
+}
+
+type MetadataProvider interface {
+	Name() string
+	Lookup(ctx context.Context, isbn13 string) (*Record, error)
+}
+
+// Result is a merged lookup. Sources lists the providers that contributed, in
+// priority order.
+type Result struct {
+	Record
+	Sources []string `json:"sources"`
+}
+
+type Config struct {
+	Providers      string
+	OpenLibraryURL string
+	FixturePath    string
+	CacheTTL       time.Duration
+	CacheSize      int
+}
+
+// degradedTTL bounds how long a result is cached when some providers failed,
+// so the missing fields are filled in once they recover.
+const degradedTTL = time.Minute
+
+var Default = &Service{Providers: []MetadataProvider{NewOpenLibraryProvider("")}, cache: newCache(time.Hour, DefaultCacheSize)}
+
+// New builds a service from a comma separated, highest priority first list of
+// provider names.
+func New(cfg Config) (*Service, error) {
+	names := cfg.Providers
+	if names == "" {
+		names = "openlibrary"
+	}
+	ttl := cfg.CacheTTL
+	if ttl == 0 {
+		ttl = time.Hour
+	}
+
+	size := cfg.CacheSize
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+
+	service := &Service{cache: newCache(ttl, size)}
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "openlibrary":
+			service.Providers = append(service.Providers, NewOpenLibraryProvider(cfg.OpenLibraryURL))
+		case "fixture":
+			if cfg.FixturePath == "" {
+				return nil, fmt.Errorf("fixture metadata provider requires a path")
+			}
+			service.Providers = append(service.Providers, &FixtureProvider{Path: cfg.FixturePath})
+		default:
+			return nil, fmt.Errorf("unknown metadata provider %q", name)
+		}
+	}
+	return service, nil
+}
+
+type Service struct {
+	Providers []MetadataProvider
+	cache     *cache
+}
+
+// Lookup asks every provider and merges their answers, earlier providers
+// winning field by field. Provider failures are only reported when nobody
+// returned anything, so one flaky provider does not break the lookup.
+func (s *Service) Lookup(ctx context.Context, isbn13 string) (result *Result, cached bool, err error) {
+	if result, ok := s.cache.get(isbn13); ok {
+		if result == nil {
+			return nil, true, ErrNotFound
+		}
+		return result, true, nil
+	}
+
+	result = &Result{Record: Record{ISBN13: isbn13}, Sources: []string{}}
+	var failures []string
+	for _, provider := range s.Providers {
+		record, err := provider.Lookup(ctx, isbn13)
+		if err != nil {
+			if !errors.Is(err, ErrNotFound) {
+				failures = append(failures, fmt.Sprintf("%s: %v", provider.Name(), err))
+			}
+			continue
+		}
+		merge(&result.Record, record)
+		result.Sources = append(result.Sources, provider.Name())
+	}
+
+	if len(result.Sources) == 0 {
+		if len(failures) > 0 {
+			return nil, false, fmt.Errorf("metadata providers failed: %s", strings.Join(failures, "; "))
+		}
+		// Misses are cached too, otherwise an unknown ISBN hits every
+		// provider on every request.
+		s.cache.set(isbn13, nil, 0)
+		return nil, false, ErrNotFound
+	}
+
+	ttl := time.Duration(0)
+	if len(failures) > 0 {
+		ttl = degradedTTL
+	}
+	s.cache.set(isbn13, result, ttl)
+	return result, false, nil
+}
+
+func merge(dst, src *Record) {
+	if dst.Title == "" {
+		dst.Title = src.Title
+	}
+	if dst.Description == "" {
+		dst.Description = src.Description
+	}
+	if dst.ImageURL == "" {
+		dst.ImageURL = src.ImageURL
+	}
+	if dst.ReleaseYear == 0 {
+		dst.ReleaseYear = src.ReleaseYear
+	}
+	if dst.TotalPage == 0 {
+		dst.TotalPage = src.TotalPage
+	}
+	if len(dst.Authors) == 0 {
+		dst.Authors = src.Authors
+	}
+}
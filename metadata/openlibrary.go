@@ -0,0 +1,125 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultOpenLibraryURL = "https://openlibrary.org"
+
+var yearPattern = regexp.MustCompile(`\b(\d{4})\b`)
+
+// OpenLibraryProvider queries the Open Library books API, or any service that
+// speaks the same format.
+type OpenLibraryProvider struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+func NewOpenLibraryProvider(baseURL string) *OpenLibraryProvider {
+	if baseURL == "" {
+		baseURL = defaultOpenLibraryURL
+	}
+	return &OpenLibraryProvider{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Client:  &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (p *OpenLibraryProvider) Name() string {
+	return "openlibrary"
+}
+
+type openLibraryBook struct {
+	Title         string          `json:"title"`
+	Subtitle      string          `json:"subtitle"`
+	NumberOfPages int             `json:"number_of_pages"`
+	PublishDate   string          `json:"publish_date"`
+	Notes         json.RawMessage `json:"notes"`
+	Authors       []struct {
+		Name string `json:"name"`
+	} `json:"authors"`
+	Cover struct {
+		Large  string `json:"large"`
+		Medium string `json:"medium"`
+	} `json:"cover"`
+}
+
+func (p *OpenLibraryProvider) Lookup(ctx context.Context, isbn13 string) (*Record, error) {
+	key := "ISBN:" + isbn13
+	query := url.Values{"bibkeys": {key}, "format": {"json"}, "jscmd": {"data"}}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.BaseURL+"/api/books?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var body map[string]openLibraryBook
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	book, ok := body[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	record := &Record{
+		ISBN13:      isbn13,
+		Title:       book.Title,
+		Description: openLibraryText(book.Notes),
+		ImageURL:    book.Cover.Large,
+		TotalPage:   book.NumberOfPages,
+	}
+	if book.Subtitle != "" {
+		record.Title += ": " + book.Subtitle
+	}
+	if record.ImageURL == "" {
+		record.ImageURL = book.Cover.Medium
+	}
+	if match := yearPattern.FindString(book.PublishDate); match != "" {
+		record.ReleaseYear, _ = strconv.Atoi(match)
+	}
+	for _, author := range book.Authors {
+		record.Authors = append(record.Authors, author.Name)
+	}
+
+	return record, nil
+}
+
+// openLibraryText reads text fields that are either a plain string or a
+// {"type": "/type/text", "value": "..."} object.
+func openLibraryText(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+
+	var typed struct {
+		Value string `json:"value"`
+	}
+	json.Unmarshal(raw, &typed)
+	return typed.Value
+}
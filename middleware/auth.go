@@ -1,37 +1,83 @@
 package middleware
 
 import (
+	"database/sql"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/database"
+	"github.com/kandlagifari/go-books-apps/problem"
 	"github.com/kandlagifari/go-books-apps/utils"
 )
 
 func AuthMiddleware(c *gin.Context) {
 	token := c.GetHeader("Authorization")
 	if token == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization token required"})
-		c.Abort()
+		problem.Abort(c, http.StatusUnauthorized, "token_required", "Authorization token required")
 		return
 	}
 
 	parts := strings.SplitN(token, " ", 2)
 	if len(parts) != 2 || parts[0] != "Bearer" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format"})
-		c.Abort()
+		problem.Abort(c, http.StatusUnauthorized, "token_invalid", "Invalid token format")
 		return
 	}
 	token = parts[1]
 
 	claims, err := utils.ValidateToken(token)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-		c.Abort()
+		problem.Abort(c, http.StatusUnauthorized, "token_invalid", "Invalid or expired token")
+		return
+	}
+
+	// The role is read from the database rather than trusted from the token,
+	// so demoting or deleting a user takes effect on their next request. The
+	// token's family must belong to the user, so a deleted user's token finds
+	// no row even if someone has registered the same username since.
+	var role string
+	var revoked bool
+	query := `
+		SELECT u.role,
+			EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = $1)
+			OR EXISTS(SELECT 1 FROM refresh_tokens WHERE family_id = $2 AND revoked_at IS NOT NULL AND replaced_by IS NULL)
+		FROM users u
+		WHERE u.username = $3
+			AND EXISTS(SELECT 1 FROM refresh_tokens WHERE family_id = $2 AND user_id = u.id)
+	`
+	err = database.DbConnection.QueryRow(query, claims.Id, claims.Family, claims.Username).Scan(&role, &revoked)
+	if err == sql.ErrNoRows {
+		problem.Abort(c, http.StatusUnauthorized, "token_revoked", "Token has been revoked")
+		return
+	}
+	if err != nil {
+		problem.Abort(c, http.StatusInternalServerError, "", "Internal server error")
+		return
+	}
+	if revoked {
+		problem.Abort(c, http.StatusUnauthorized, "token_revoked", "Token has been revoked")
 		return
 	}
 
 	c.Set("user", claims.Username)
+	c.Set("role", role)
+	c.Set("token_id", claims.Id)
+	c.Set("token_family", claims.Family)
+	c.Set("token_expires_at", time.Unix(claims.ExpiresAt, 0))
 
 	c.Next()
 }
+
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		if !slices.Contains(roles, role) {
+			problem.Abort(c, http.StatusForbidden, "insufficient_role", "Insufficient permissions")
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StreamTimeout replaces the server's read and write timeouts on routes that
+// move whole catalogues, such as imports and exports, which can take far
+// longer than a normal request. 0 removes the deadlines.
+var StreamTimeout = 30 * time.Minute
+
+// LongRunning extends the connection deadlines for the rest of the request.
+// It must run before anything reads the request body.
+func LongRunning(c *gin.Context) {
+	var deadline time.Time
+	if StreamTimeout > 0 {
+		deadline = time.Now().Add(StreamTimeout)
+	}
+
+	// Writers that cannot change deadlines, as in tests, keep the defaults.
+	controller := http.NewResponseController(c.Writer)
+	_ = controller.SetReadDeadline(deadline)
+	_ = controller.SetWriteDeadline(deadline)
+
+	c.Next()
+}
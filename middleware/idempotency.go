@@ -0,0 +1,202 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/idempotency"
+	"github.com/kandlagifari/go-books-apps/problem"
+)
+
+const (
+	maxIdempotencyKeyLength = 255
+	// Request bodies larger than this are spooled to a temporary file while
+	// they are fingerprinted, so large imports are not held in memory.
+	idempotencyMemoryLimit = 1 << 20
+)
+
+// IdempotentBodyLimit caps the request body of a request with an
+// Idempotency-Key, since the whole body is read before the handler runs.
+var IdempotentBodyLimit int64 = 64 << 20
+
+// replayedHeaders are the response headers stored with a response and sent
+// again when it is replayed.
+var replayedHeaders = []string{"Content-Type", "Content-Language", "Location", "ETag", "Preference-Applied"}
+
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Unwrap lets http.ResponseController reach the connection, for example to
+// extend deadlines.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
+
+type spooledFile struct {
+	*os.File
+}
+
+func (f spooledFile) Close() error {
+	f.File.Close()
+	return os.Remove(f.Name())
+}
+
+// spoolRequest fingerprints the request and returns a replacement body, since
+// hashing consumes the original one.
+func spoolRequest(w http.ResponseWriter, r *http.Request) (string, io.ReadCloser, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, IdempotentBodyLimit)
+
+	hash := sha256.New()
+	io.WriteString(hash, r.Method+" "+r.URL.RequestURI()+"\x00"+r.Header.Get("Content-Type")+"\x00")
+
+	var buffer bytes.Buffer
+	_, err := io.CopyN(io.MultiWriter(hash, &buffer), r.Body, idempotencyMemoryLimit+1)
+	if err == io.EOF {
+		return hex.EncodeToString(hash.Sum(nil)), io.NopCloser(&buffer), nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	file, err := os.CreateTemp("", "idempotency-*")
+	if err != nil {
+		return "", nil, err
+	}
+	spooled := spooledFile{file}
+	if _, err := file.Write(buffer.Bytes()); err != nil {
+		spooled.Close()
+		return "", nil, err
+	}
+	if _, err := io.Copy(io.MultiWriter(hash, file), r.Body); err != nil {
+		spooled.Close()
+		return "", nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		spooled.Close()
+		return "", nil, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), spooled, nil
+}
+
+// idempotencyScope is who a key belongs to: the user, or on anonymous routes
+// such as registration the client's address, so unrelated clients that pick
+// the same key never see each other's responses. The NUL byte keeps an
+// address apart from any username.
+func idempotencyScope(c *gin.Context) string {
+	if user := c.GetString("user"); user != "" {
+		return user
+	}
+	return "\x00" + c.ClientIP()
+}
+
+// Idempotency makes POST requests that carry an Idempotency-Key header safe to
+// retry. The first response for a key is stored and replayed for repeats of
+// the same request; reusing the key for a different request is rejected.
+// Server errors and authorisation failures are not stored, so they can be
+// retried with the same key. It must run after AuthMiddleware on routes that
+// need a user, because keys are scoped per user, and after RequireRole, so a
+// caller without the role cannot make the server read and store its body.
+func Idempotency(c *gin.Context) {
+	key := c.GetHeader("Idempotency-Key")
+	if c.Request.Method != http.MethodPost || key == "" {
+		c.Next()
+		return
+	}
+
+	if len(key) > maxIdempotencyKeyLength {
+		problem.Abort(c, http.StatusBadRequest, "", "Idempotency-Key must be at most 255 characters")
+		return
+	}
+
+	fingerprint, body, err := spoolRequest(c.Writer, c.Request)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			problem.Abort(c, http.StatusRequestEntityTooLarge, "", "Request body must be at most %d bytes", IdempotentBodyLimit)
+			return
+		}
+		problem.Abort(c, http.StatusBadRequest, "", "Invalid input")
+		return
+	}
+	defer body.Close()
+	c.Request.Body = body
+
+	// Storing the outcome must not be skipped because the client went away.
+	ctx := context.WithoutCancel(c.Request.Context())
+	scopedKey := idempotency.ScopedKey(idempotencyScope(c), c.Request.Method, c.Request.URL.Path, key)
+
+	record, err := idempotency.Default.Reserve(ctx, scopedKey, fingerprint)
+	if err != nil {
+		problem.Abort(c, http.StatusInternalServerError, "", "Internal server error")
+		return
+	}
+	if record != nil {
+		switch {
+		case record.Fingerprint != fingerprint:
+			problem.RespondCode(c, http.StatusUnprocessableEntity, "idempotency_key_reused", "Idempotency-Key was already used for a different request")
+		case record.Response == nil:
+			c.Header("Retry-After", "1")
+			problem.RespondCode(c, http.StatusConflict, "idempotency_key_in_use", "A request with this Idempotency-Key is still being processed")
+		default:
+			for name, values := range record.Response.Header {
+				for _, value := range values {
+					c.Writer.Header().Add(name, value)
+				}
+			}
+			c.Header("Idempotent-Replayed", "true")
+			c.Writer.WriteHeader(record.Response.Status)
+			c.Writer.Write(record.Response.Body)
+		}
+		c.Abort()
+		return
+	}
+
+	stop := idempotency.KeepAlive(ctx, idempotency.Default, scopedKey)
+	defer stop()
+
+	completed := false
+	// Also runs when the handler panics, so the key does not stay reserved.
+	defer func() {
+		if !completed {
+			idempotency.Default.Release(ctx, scopedKey)
+		}
+	}()
+
+	recorder := &responseRecorder{ResponseWriter: c.Writer}
+	c.Writer = recorder
+	c.Next()
+
+	status := recorder.Status()
+	if status >= http.StatusInternalServerError || status == http.StatusUnauthorized || status == http.StatusForbidden {
+		return
+	}
+
+	header := http.Header{}
+	for _, name := range replayedHeaders {
+		if value := recorder.Header().Get(name); value != "" {
+			header.Set(name, value)
+		}
+	}
+	if err := idempotency.Default.Complete(ctx, scopedKey, &idempotency.Response{Status: status, Header: header, Body: recorder.body.Bytes()}); err == nil {
+		completed = true
+	}
+}
@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/i18n"
+)
+
+// Language picks the language of the response from the lang query parameter
+// or, failing that, the Accept-Language header.
+func Language(c *gin.Context) {
+	lang := i18n.Default.Match(c.Query("lang"), c.GetHeader("Accept-Language"))
+	i18n.SetLanguage(c, lang)
+
+	c.Header("Content-Language", lang)
+	c.Writer.Header().Add("Vary", "Accept-Language")
+
+	c.Next()
+}
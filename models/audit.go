@@ -0,0 +1,54 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+const (
+	AuditActionCreate  = "create"
+	AuditActionUpdate  = "update"
+	AuditActionDelete  = "delete"
+	AuditActionRestore = "restore"
+	AuditActionPurge   = "purge"
+
+	AuditActionPasswordReset = "password_reset"
+)
+
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	Actor     sql.NullString  `json:"actor"`
+	Action    string          `json:"action"`
+	Entity    string          `json:"entity"`
+	EntityID  sql.NullInt64   `json:"entity_id"`
+	Changes   json.RawMessage `json:"changes"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type CustomAuditEntry struct {
+	ID        int64           `json:"id"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	Entity    string          `json:"entity"`
+	EntityID  *int64          `json:"entity_id"`
+	Changes   json.RawMessage `json:"changes"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+func (a *AuditEntry) MarshalJSON() ([]byte, error) {
+	var entityID *int64
+	if a.EntityID.Valid {
+		entityID = &a.EntityID.Int64
+	}
+
+	return json.Marshal(CustomAuditEntry{
+		ID:        a.ID,
+		Actor:     a.Actor.String,
+		Action:    a.Action,
+		Entity:    a.Entity,
+		EntityID:  entityID,
+		Changes:   a.Changes,
+		CreatedAt: a.CreatedAt,
+	})
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+const (
+	AuthorRoleAuthor      = "author"
+	AuthorRoleEditor      = "editor"
+	AuthorRoleTranslator  = "translator"
+	AuthorRoleIllustrator = "illustrator"
+)
+
+var AuthorRoles = []string{AuthorRoleAuthor, AuthorRoleEditor, AuthorRoleTranslator, AuthorRoleIllustrator}
+
+type Author struct {
+	ID         int            `json:"id"`
+	Name       string         `json:"name" binding:"required,max=255"`
+	Bio        string         `json:"bio"`
+	CreatedAt  time.Time      `json:"created_at"`
+	CreatedBy  sql.NullString `json:"created_by"`
+	ModifiedAt time.Time      `json:"modified_at"`
+	ModifiedBy sql.NullString `json:"modified_by"`
+}
+
+type CustomAuthor struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	Bio        string    `json:"bio"`
+	CreatedAt  time.Time `json:"created_at"`
+	CreatedBy  string    `json:"created_by"`
+	ModifiedAt time.Time `json:"modified_at"`
+	ModifiedBy string    `json:"modified_by"`
+}
+
+func (a *Author) MarshalJSON() ([]byte, error) {
+	return json.Marshal(CustomAuthor{
+		ID:         a.ID,
+		Name:       a.Name,
+		Bio:        a.Bio,
+		CreatedAt:  a.CreatedAt,
+		CreatedBy:  a.CreatedBy.String,
+		ModifiedAt: a.ModifiedAt,
+		ModifiedBy: a.ModifiedBy.String,
+	})
+}
+
+type BookAuthor struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+	Position int    `json:"position"`
+}
@@ -7,51 +7,97 @@ import (
 )
 
 type Book struct {
-	ID          int            `json:"id"`
-	Title       string         `json:"title"`
-	Description string         `json:"description"`
-	ImageURL    string         `json:"image_url"`
-	ReleaseYear int            `json:"release_year"`
-	Price       int            `json:"price"`
-	TotalPage   int            `json:"total_page"`
-	Thickness   string         `json:"thickness"`
-	CategoryID  int            `json:"category_id"`
-	CreatedAt   time.Time      `json:"created_at"`
-	CreatedBy   sql.NullString `json:"created_by"`
-	ModifiedAt  time.Time      `json:"modified_at"`
-	ModifiedBy  sql.NullString `json:"modified_by"`
+	ID             int            `json:"id"`
+	Title          string         `json:"title" binding:"required,max=255"`
+	ISBN           string         `json:"isbn"`
+	ISBN10         string         `json:"isbn10"`
+	ISBN13         string         `json:"isbn13"`
+	Description    string         `json:"description" binding:"max=255"`
+	ImageURL       string         `json:"image_url" binding:"max=255"`
+	ReleaseYear    int            `json:"release_year"`
+	Price          int            `json:"price" binding:"gte=0"`
+	TotalPage      int            `json:"total_page" binding:"gte=0"`
+	Thickness      string         `json:"thickness"`
+	ThicknessLabel string         `json:"-"`
+	CategoryID     int            `json:"category_id"`
+	CreatedAt      time.Time      `json:"created_at"`
+	CreatedBy      sql.NullString `json:"created_by"`
+	ModifiedAt     time.Time      `json:"modified_at"`
+	ModifiedBy     sql.NullString `json:"modified_by"`
+	DeletedAt      sql.NullTime   `json:"-"`
+	DeletedBy      sql.NullString `json:"-"`
+	Version        int            `json:"-"`
+	Authors        []BookAuthor   `json:"authors"`
+	AuthorIDs      []int          `json:"author_ids"`
+	Tags           []string       `json:"-"`
 }
 
 type CustomBook struct {
-	ID          int       `json:"id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	ImageURL    string    `json:"image_url"`
-	ReleaseYear int       `json:"release_year"`
-	Price       int       `json:"price"`
-	TotalPage   int       `json:"total_page"`
-	Thickness   string    `json:"thickness"`
-	CategoryID  int       `json:"category_id"`
-	CreatedAt   time.Time `json:"created_at"`
-	CreatedBy   string    `json:"created_by"`
-	ModifiedAt  time.Time `json:"modified_at"`
-	ModifiedBy  string    `json:"modified_by"`
+	ID             int          `json:"id"`
+	Title          string       `json:"title"`
+	ISBN10         string       `json:"isbn10"`
+	ISBN13         string       `json:"isbn13"`
+	Description    string       `json:"description"`
+	ImageURL       string       `json:"image_url"`
+	ReleaseYear    int          `json:"release_year"`
+	Price          int          `json:"price"`
+	TotalPage      int          `json:"total_page"`
+	Thickness      string       `json:"thickness"`
+	ThicknessLabel string       `json:"thickness_label,omitempty"`
+	CategoryID     int          `json:"category_id"`
+	CreatedAt      time.Time    `json:"created_at"`
+	CreatedBy      string       `json:"created_by"`
+	ModifiedAt     time.Time    `json:"modified_at"`
+	ModifiedBy     string       `json:"modified_by"`
+	DeletedAt      *time.Time   `json:"deleted_at,omitempty"`
+	DeletedBy      string       `json:"deleted_by,omitempty"`
+	Version        int          `json:"version"`
+	Authors        []BookAuthor `json:"authors"`
+	Tags           []string     `json:"tags"`
+}
+
+// ToCustom converts the book into the shape it is served in.
+func (b *Book) ToCustom() CustomBook {
+	authors := b.Authors
+	if authors == nil {
+		authors = []BookAuthor{}
+	}
+
+	tags := b.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	var deletedAt *time.Time
+	if b.DeletedAt.Valid {
+		deletedAt = &b.DeletedAt.Time
+	}
+
+	return CustomBook{
+		ID:             b.ID,
+		Title:          b.Title,
+		ISBN10:         b.ISBN10,
+		ISBN13:         b.ISBN13,
+		Description:    b.Description,
+		ImageURL:       b.ImageURL,
+		ReleaseYear:    b.ReleaseYear,
+		Price:          b.Price,
+		TotalPage:      b.TotalPage,
+		Thickness:      b.Thickness,
+		ThicknessLabel: b.ThicknessLabel,
+		CategoryID:     b.CategoryID,
+		CreatedAt:      b.CreatedAt,
+		CreatedBy:      b.CreatedBy.String,
+		ModifiedAt:     b.ModifiedAt,
+		ModifiedBy:     b.ModifiedBy.String,
+		DeletedAt:      deletedAt,
+		DeletedBy:      b.DeletedBy.String,
+		Version:        b.Version,
+		Authors:        authors,
+		Tags:           tags,
+	}
 }
 
 func (b *Book) MarshalJSON() ([]byte, error) {
-	return json.Marshal(CustomBook{
-		ID:          b.ID,
-		Title:       b.Title,
-		Description: b.Description,
-		ImageURL:    b.ImageURL,
-		ReleaseYear: b.ReleaseYear,
-		Price:       b.Price,
-		TotalPage:   b.TotalPage,
-		Thickness:   b.Thickness,
-		CategoryID:  b.CategoryID,
-		CreatedAt:   b.CreatedAt,
-		CreatedBy:   b.CreatedBy.String,
-		ModifiedAt:  b.ModifiedAt,
-		ModifiedBy:  b.ModifiedBy.String,
-	})
+	return json.Marshal(b.ToCustom())
 }
@@ -8,29 +8,54 @@ import (
 
 type Category struct {
 	ID         int            `json:"id"`
-	Name       string         `json:"name"`
+	Name       string         `json:"name" binding:"required,max=255"`
+	ParentID   *int           `json:"parent_id"`
 	CreatedAt  time.Time      `json:"created_at"`
 	CreatedBy  sql.NullString `json:"created_by"`
 	ModifiedAt time.Time      `json:"modified_at"`
 	ModifiedBy sql.NullString `json:"modified_by"`
+	DeletedAt  sql.NullTime   `json:"-"`
+	DeletedBy  sql.NullString `json:"-"`
+	Version    int            `json:"-"`
 }
 
 type CustomCategory struct {
-	ID         int       `json:"id"`
-	Name       string    `json:"name"`
-	CreatedAt  time.Time `json:"created_at"`
-	CreatedBy  string    `json:"created_by"`
-	ModifiedAt time.Time `json:"modified_at"`
-	ModifiedBy string    `json:"modified_by"`
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	ParentID   *int       `json:"parent_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	CreatedBy  string     `json:"created_by"`
+	ModifiedAt time.Time  `json:"modified_at"`
+	ModifiedBy string     `json:"modified_by"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy  string     `json:"deleted_by,omitempty"`
+	Version    int        `json:"version"`
 }
 
 func (c *Category) MarshalJSON() ([]byte, error) {
+	var deletedAt *time.Time
+	if c.DeletedAt.Valid {
+		deletedAt = &c.DeletedAt.Time
+	}
+
 	return json.Marshal(CustomCategory{
 		ID:         c.ID,
 		Name:       c.Name,
+		ParentID:   c.ParentID,
 		CreatedAt:  c.CreatedAt,
 		CreatedBy:  c.CreatedBy.String,
 		ModifiedAt: c.ModifiedAt,
 		ModifiedBy: c.ModifiedBy.String,
+		DeletedAt:  deletedAt,
+		DeletedBy:  c.DeletedBy.String,
+		Version:    c.Version,
 	})
 }
+
+// CategoryNode is a category with its subcategories nested underneath.
+type CategoryNode struct {
+	ID       int             `json:"id"`
+	Name     string          `json:"name"`
+	ParentID *int            `json:"parent_id"`
+	Children []*CategoryNode `json:"children"`
+}
@@ -5,12 +5,23 @@ import (
 	"time"
 )
 
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleReader = "reader"
+)
+
+var Roles = []string{RoleAdmin, RoleEditor, RoleReader}
+
 type User struct {
-	ID         int            `json:"id"`
-	Username   string         `json:"username"`
-	Password   string         `json:"password"`
-	CreatedAt  time.Time      `json:"created_at"`
-	CreatedBy  sql.NullString `json:"created_by"`
-	ModifiedAt time.Time      `json:"modified_at"`
-	ModifiedBy sql.NullString `json:"modified_by"`
+	ID              int            `json:"id"`
+	Username        string         `json:"username" binding:"required,min=3,max=50"`
+	Password        string         `json:"password" binding:"required,min=8,max=72"`
+	Email           string         `json:"email" binding:"required,email,max=255"`
+	EmailVerifiedAt sql.NullTime   `json:"email_verified_at"`
+	Role            string         `json:"role"`
+	CreatedAt       time.Time      `json:"created_at"`
+	CreatedBy       sql.NullString `json:"created_by"`
+	ModifiedAt      time.Time      `json:"modified_at"`
+	ModifiedBy      sql.NullString `json:"modified_by"`
 }
@@ -0,0 +1,262 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/kandlagifari/go-books-apps/i18n"
+)
+
+// ContentType is the media type of every error response (RFC 7807).
+const ContentType = "application/problem+json"
+
+const (
+	CodeValidationFailed = "validation_failed"
+	CodeInvalidJSON      = "invalid_json"
+)
+
+// statusCodes holds the default code for each status. Handlers pass a more
+// specific code where a client is expected to react to it.
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            "invalid_input",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusConflict:              "conflict",
+	http.StatusPreconditionFailed:    "precondition_failed",
+	http.StatusRequestEntityTooLarge: "payload_too_large",
+	http.StatusUnsupportedMediaType:  "unsupported_media_type",
+	http.StatusUnprocessableEntity:   "unprocessable_entity",
+	http.StatusPreconditionRequired:  "precondition_required",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusBadGateway:            "bad_gateway",
+	http.StatusServiceUnavailable:    "service_unavailable",
+}
+
+// Violation is one invalid field of a request.
+type Violation struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Problem is the body of every error response. Type is always about:blank,
+// so Title is the HTTP status text and Code tells errors apart.
+type Problem struct {
+	Type     string      `json:"type"`
+	Title    string      `json:"title"`
+	Status   int         `json:"status"`
+	Code     string      `json:"code"`
+	Detail   string      `json:"detail"`
+	Instance string      `json:"instance,omitempty"`
+	Errors   []Violation `json:"errors,omitempty"`
+}
+
+// FieldError is a validation error that belongs to a single field. Handlers
+// return it from shared validation so the field ends up in the response. The
+// message is translated when the response is written.
+type FieldError struct {
+	Field   string
+	Code    string
+	Message *i18n.Message
+}
+
+func NewFieldError(field, code, format string, args ...any) *FieldError {
+	return &FieldError{Field: field, Code: code, Message: &i18n.Message{Format: format, Args: args}}
+}
+
+func (e *FieldError) Error() string {
+	return e.Message.Error()
+}
+
+func init() {
+	// Report fields by their JSON names rather than Go struct field names.
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+	}
+}
+
+func codeFor(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// Complete fills in the members derived from the status and request. Write
+// calls it; handlers that add extension members to the body call it before
+// embedding p in their own response.
+func Complete(c *gin.Context, p *Problem) *Problem {
+	p.Type = "about:blank"
+	p.Title = http.StatusText(p.Status)
+	if p.Code == "" {
+		p.Code = codeFor(p.Status)
+	}
+	if p.Instance == "" {
+		p.Instance = c.Request.URL.Path
+	}
+	return p
+}
+
+// Write sends p as the response.
+func Write(c *gin.Context, p *Problem) {
+	Complete(c, p)
+	c.Header("Content-Type", ContentType)
+	c.JSON(p.Status, p)
+}
+
+// Respond sends an error with the default code for status. The detail is
+// translated into the request's language before args are filled in.
+func Respond(c *gin.Context, status int, detail string, args ...any) {
+	Write(c, &Problem{Status: status, Detail: i18n.T(c, detail, args...)})
+}
+
+// RespondCode sends an error with a specific code.
+func RespondCode(c *gin.Context, status int, code, detail string, args ...any) {
+	Write(c, &Problem{Status: status, Code: code, Detail: i18n.T(c, detail, args...)})
+}
+
+// Abort sends an error from a middleware and stops the handler chain. An
+// empty code uses the default for status.
+func Abort(c *gin.Context, status int, code, detail string, args ...any) {
+	RespondCode(c, status, code, detail, args...)
+	c.Abort()
+}
+
+// FromError sends err with the given status. Binding, validation and field
+// errors are reported field by field; anything else becomes the detail.
+func FromError(c *gin.Context, status int, err error) {
+	if violations := Violations(c, err); len(violations) > 0 {
+		detail := violations[0].Message
+		if len(violations) > 1 {
+			detail = i18n.T(c, "Request has %d invalid fields", len(violations))
+		}
+		Write(c, &Problem{Status: status, Code: CodeValidationFailed, Detail: detail, Errors: violations})
+		return
+	}
+
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.Is(err, io.EOF):
+		RespondCode(c, status, CodeInvalidJSON, "Request body is required")
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		RespondCode(c, status, CodeInvalidJSON, "Request body is not valid JSON")
+	default:
+		Write(c, &Problem{Status: status, Detail: i18n.Error(c, err)})
+	}
+}
+
+// Violations lists the invalid fields described by err, if any, with their
+// messages in the request's language.
+func Violations(c *gin.Context, err error) []Violation {
+	var fieldErr *FieldError
+	if errors.As(err, &fieldErr) {
+		return []Violation{{Field: fieldErr.Field, Code: fieldErr.Code, Message: i18n.Error(c, fieldErr.Message)}}
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return []Violation{{Field: typeErr.Field, Code: "type", Message: i18n.T(c, "%s must be "+jsonType(typeErr.Type), typeErr.Field)}}
+	}
+
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return nil
+	}
+
+	violations := make([]Violation, 0, len(validationErrs))
+	for _, fe := range validationErrs {
+		violations = append(violations, Violation{Field: fieldPath(fe), Code: fe.Tag(), Message: message(c, fe)})
+	}
+	return violations
+}
+
+// fieldPath is the JSON path of a field below the bound struct, for example
+// "authors[0].id".
+func fieldPath(fe validator.FieldError) string {
+	_, path, found := strings.Cut(fe.Namespace(), ".")
+	if !found {
+		return fe.Field()
+	}
+	return path
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a whole number"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	default:
+		return "a string"
+	}
+}
+
+func message(c *gin.Context, fe validator.FieldError) string {
+	field := fe.Field()
+
+	// min and max count characters of strings and items of lists.
+	unit := ""
+	switch fe.Kind() {
+	case reflect.String:
+		unit = "characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		unit = "items"
+		if fe.Param() == "1" {
+			unit = "item"
+		}
+	}
+
+	switch fe.Tag() {
+	case "required":
+		return i18n.T(c, "%s is required", field)
+	case "min":
+		if unit == "" {
+			return i18n.T(c, "%s must be at least %s", field, fe.Param())
+		}
+		return i18n.T(c, "%s must have at least %s "+unit, field, fe.Param())
+	case "max":
+		if unit == "" {
+			return i18n.T(c, "%s must be at most %s", field, fe.Param())
+		}
+		return i18n.T(c, "%s must have at most %s "+unit, field, fe.Param())
+	case "gte":
+		return i18n.T(c, "%s must be greater than or equal to %s", field, fe.Param())
+	case "gt":
+		return i18n.T(c, "%s must be greater than %s", field, fe.Param())
+	case "lte":
+		return i18n.T(c, "%s must be less than or equal to %s", field, fe.Param())
+	case "email":
+		return i18n.T(c, "%s must be a valid email address", field)
+	case "url":
+		return i18n.T(c, "%s must be a valid URL", field)
+	case "oneof":
+		return i18n.T(c, "%s must be one of: %s", field, strings.ReplaceAll(fe.Param(), " ", ", "))
+	default:
+		return i18n.T(c, "%s is invalid (%s)", field, fe.Tag())
+	}
+}
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/controllers"
+	"github.com/kandlagifari/go-books-apps/middleware"
+	"github.com/kandlagifari/go-books-apps/models"
+)
+
+func RegisterAuditRoutes(router *gin.Engine) {
+	auditGroup := router.Group("/api/audit", middleware.AuthMiddleware, middleware.RequireRole(models.RoleAdmin))
+	{
+		auditGroup.GET("", controllers.GetAuditLog)
+	}
+}
@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/controllers"
+	"github.com/kandlagifari/go-books-apps/middleware"
+	"github.com/kandlagifari/go-books-apps/models"
+)
+
+func RegisterAuthorRoutes(router *gin.Engine) {
+	editors := middleware.RequireRole(models.RoleEditor, models.RoleAdmin)
+	admins := middleware.RequireRole(models.RoleAdmin)
+
+	authorGroup := router.Group("/api/authors", middleware.AuthMiddleware)
+	{
+		authorGroup.GET("", controllers.GetAuthors)
+		authorGroup.POST("", editors, middleware.Idempotency, controllers.CreateAuthor)
+		authorGroup.GET("/:id", controllers.GetAuthorByID)
+		authorGroup.DELETE("/:id", admins, controllers.DeleteAuthor)
+		authorGroup.PUT("/:id", editors, controllers.UpdateAuthor)
+		authorGroup.GET("/:id/books", controllers.GetBooksByAuthorID)
+	}
+}
@@ -4,15 +4,34 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/kandlagifari/go-books-apps/controllers"
 	"github.com/kandlagifari/go-books-apps/middleware"
+	"github.com/kandlagifari/go-books-apps/models"
 )
 
 func RegisterBookRoutes(router *gin.Engine) {
+	editors := middleware.RequireRole(models.RoleEditor, models.RoleAdmin)
+	admins := middleware.RequireRole(models.RoleAdmin)
+
 	bookGroup := router.Group("/api/books", middleware.AuthMiddleware)
 	{
 		bookGroup.GET("", controllers.GetBooks)
-		bookGroup.POST("", controllers.CreateBook)
+		bookGroup.POST("", editors, middleware.Idempotency, controllers.CreateBook)
+		bookGroup.GET("/search", controllers.SearchBooks)
+		bookGroup.GET("/export", middleware.LongRunning, controllers.ExportBooks)
+		bookGroup.GET("/isbn/:isbn", controllers.GetBookByISBN)
+		bookGroup.POST("/import", editors, middleware.LongRunning, middleware.Idempotency, controllers.ImportBooks)
+		bookGroup.POST("/lookup", editors, middleware.Idempotency, controllers.LookupBook)
 		bookGroup.GET("/:id", controllers.GetBookByID)
-		bookGroup.DELETE("/:id", controllers.DeleteBook)
-		bookGroup.PUT("/:id", controllers.UpdateBook)
+		bookGroup.GET("/:id/history", editors, controllers.GetBookHistory)
+		bookGroup.DELETE("/:id", admins, controllers.DeleteBook)
+		bookGroup.POST("/:id/restore", admins, middleware.Idempotency, controllers.RestoreBook)
+		bookGroup.PUT("/:id", editors, controllers.UpdateBook)
+		bookGroup.PATCH("/:id", editors, controllers.PatchBook)
+		bookGroup.POST("/:id/cover", editors, middleware.Idempotency, controllers.UploadBookCover)
+		bookGroup.POST("/:id/tags", editors, middleware.Idempotency, controllers.AddBookTags)
+		bookGroup.DELETE("/:id/tags/:tag", editors, controllers.RemoveBookTag)
 	}
+
+	// Covers are linked from image_url and loaded by <img> tags, which cannot
+	// send a bearer token, so they are served without authentication.
+	router.GET("/api/books/:id/cover", controllers.GetBookCover)
 }
@@ -4,16 +4,24 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/kandlagifari/go-books-apps/controllers"
 	"github.com/kandlagifari/go-books-apps/middleware"
+	"github.com/kandlagifari/go-books-apps/models"
 )
 
 func RegisterCategoryRoutes(router *gin.Engine) {
+	editors := middleware.RequireRole(models.RoleEditor, models.RoleAdmin)
+	admins := middleware.RequireRole(models.RoleAdmin)
+
 	categoryGroup := router.Group("/api/categories", middleware.AuthMiddleware)
 	{
 		categoryGroup.GET("", controllers.GetCategories)
-		categoryGroup.POST("", controllers.CreateCategory)
+		categoryGroup.POST("", editors, middleware.Idempotency, controllers.CreateCategory)
+		categoryGroup.GET("/tree", controllers.GetCategoryTree)
 		categoryGroup.GET("/:id", controllers.GetCategoryByID)
-		categoryGroup.DELETE("/:id", controllers.DeleteCategory)
-		categoryGroup.PUT("/:id", controllers.UpdateCategory)
+		categoryGroup.DELETE("/:id", admins, controllers.DeleteCategory)
+		categoryGroup.POST("/:id/restore", admins, middleware.Idempotency, controllers.RestoreCategory)
+		categoryGroup.PUT("/:id", editors, controllers.UpdateCategory)
+		categoryGroup.PATCH("/:id", editors, controllers.PatchCategory)
+		categoryGroup.POST("/:id/move", editors, middleware.Idempotency, controllers.MoveCategory)
 		categoryGroup.GET("/:id/books", controllers.GetBooksByCategoryID)
 	}
 }
@@ -0,0 +1,11 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/controllers"
+)
+
+func RegisterHealthRoutes(router *gin.Engine) {
+	router.GET("/healthz", controllers.Liveness)
+	router.GET("/readyz", controllers.Readiness)
+}
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/controllers"
+	"github.com/kandlagifari/go-books-apps/middleware"
+	"github.com/kandlagifari/go-books-apps/models"
+)
+
+func RegisterRuleRoutes(router *gin.Engine) {
+	admins := middleware.RequireRole(models.RoleAdmin)
+
+	ruleGroup := router.Group("/api/rules", middleware.AuthMiddleware)
+	{
+		ruleGroup.GET("", controllers.GetRules)
+		ruleGroup.POST("/recompute-thickness", admins, controllers.RecomputeThickness)
+	}
+}
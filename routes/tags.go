@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/controllers"
+	"github.com/kandlagifari/go-books-apps/middleware"
+)
+
+func RegisterTagRoutes(router *gin.Engine) {
+	tagGroup := router.Group("/api/tags", middleware.AuthMiddleware)
+	{
+		tagGroup.GET("", controllers.GetTags)
+	}
+}
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/kandlagifari/go-books-apps/controllers"
+	"github.com/kandlagifari/go-books-apps/middleware"
+	"github.com/kandlagifari/go-books-apps/models"
+)
+
+func RegisterTrashRoutes(router *gin.Engine) {
+	trashGroup := router.Group("/api/trash", middleware.AuthMiddleware, middleware.RequireRole(models.RoleAdmin))
+	{
+		trashGroup.GET("", controllers.GetTrash)
+		trashGroup.DELETE("", controllers.EmptyTrash)
+		trashGroup.DELETE("/books/:id", controllers.PurgeBook)
+		trashGroup.DELETE("/categories/:id", controllers.PurgeCategory)
+	}
+}
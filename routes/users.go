@@ -3,12 +3,24 @@ package routes
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/kandlagifari/go-books-apps/controllers"
+	"github.com/kandlagifari/go-books-apps/middleware"
+	"github.com/kandlagifari/go-books-apps/models"
 )
 
 func RegisterAuthRoutes(router *gin.Engine) {
+	admins := middleware.RequireRole(models.RoleAdmin)
+
 	authGroup := router.Group("/api/users")
 	{
-		authGroup.POST("/register", controllers.Register)
+		authGroup.POST("/register", middleware.Idempotency, controllers.Register)
 		authGroup.POST("/login", controllers.Login)
+		authGroup.POST("/refresh", controllers.RefreshToken)
+		authGroup.POST("/logout", middleware.AuthMiddleware, controllers.Logout)
+		authGroup.POST("/verify-email", controllers.VerifyEmail)
+		authGroup.POST("/forgot-password", controllers.ForgotPassword)
+		authGroup.POST("/reset-password", controllers.ResetPassword)
+		authGroup.GET("", middleware.AuthMiddleware, admins, controllers.GetUsers)
+		authGroup.PUT("/:id/role", middleware.AuthMiddleware, admins, controllers.UpdateUserRole)
+		authGroup.DELETE("/:id", middleware.AuthMiddleware, admins, controllers.DeleteUser)
 	}
 }
@@ -0,0 +1,151 @@
+package rules
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kandlagifari/go-books-apps/i18n"
+)
+
+const (
+	DefaultMinReleaseYear    = 1980
+	DefaultReleaseYearsAhead = 1
+	DefaultThicknessBuckets  = "thin:100,thick"
+
+	// maxBucketNameLength matches the books.thickness column.
+	maxBucketNameLength = 50
+)
+
+// Bucket classifies books with at most MaxPages pages. The last bucket has
+// no MaxPages and takes every book the earlier ones did not.
+type Bucket struct {
+	Name     string `json:"name"`
+	MaxPages int    `json:"max_pages,omitempty"`
+}
+
+// Rules are the business rules applied to every book that is written.
+type Rules struct {
+	MinReleaseYear int
+	// MaxReleaseYear is a fixed upper bound. When it is 0 the bound moves
+	// with the calendar: the current year plus ReleaseYearsAhead.
+	MaxReleaseYear    int
+	ReleaseYearsAhead int
+	Buckets           []Bucket
+}
+
+// Config holds the settings as loaded by the config package. An empty
+// ThicknessBuckets uses DefaultThicknessBuckets.
+type Config struct {
+	MinReleaseYear    int
+	MaxReleaseYear    int
+	ReleaseYearsAhead int
+	ThicknessBuckets  string
+}
+
+var Default = &Rules{
+	MinReleaseYear:    DefaultMinReleaseYear,
+	ReleaseYearsAhead: DefaultReleaseYearsAhead,
+	Buckets:           []Bucket{{Name: "thin", MaxPages: 100}, {Name: "thick"}},
+}
+
+func New(cfg Config) (*Rules, error) {
+	if cfg.MinReleaseYear < 0 || cfg.MaxReleaseYear < 0 || cfg.ReleaseYearsAhead < 0 {
+		return nil, i18n.Errorf("release year settings must not be negative")
+	}
+	if cfg.MaxReleaseYear != 0 && cfg.MaxReleaseYear < cfg.MinReleaseYear {
+		return nil, i18n.Errorf("maximum release year %d is before the minimum %d", cfg.MaxReleaseYear, cfg.MinReleaseYear)
+	}
+	r := &Rules{MinReleaseYear: cfg.MinReleaseYear, MaxReleaseYear: cfg.MaxReleaseYear, ReleaseYearsAhead: cfg.ReleaseYearsAhead}
+
+	spec := cfg.ThicknessBuckets
+	if spec == "" {
+		spec = DefaultThicknessBuckets
+	}
+	buckets, err := ParseBuckets(spec)
+	if err != nil {
+		return nil, err
+	}
+	r.Buckets = buckets
+
+	return r, nil
+}
+
+// ParseBuckets reads thickness buckets written as "name:max_pages,...,name",
+// for example "thin:100,medium:300,thick". Thresholds must increase and the
+// last bucket has none.
+func ParseBuckets(spec string) ([]Bucket, error) {
+	parts := strings.Split(spec, ",")
+	buckets := make([]Bucket, 0, len(parts))
+	seen := map[string]bool{}
+
+	for i, part := range parts {
+		name, rawMax, hasMax := strings.Cut(strings.TrimSpace(part), ":")
+		name = strings.TrimSpace(name)
+		if name == "" || len(name) > maxBucketNameLength {
+			return nil, i18n.Errorf("invalid thickness bucket %q", part)
+		}
+		if seen[name] {
+			return nil, i18n.Errorf("thickness bucket %q is listed twice", name)
+		}
+		seen[name] = true
+
+		last := i == len(parts)-1
+		if last != !hasMax {
+			return nil, i18n.Errorf("every thickness bucket except the last needs a page limit, as in %q", DefaultThicknessBuckets)
+		}
+
+		bucket := Bucket{Name: name}
+		if hasMax {
+			maxPages, err := strconv.Atoi(strings.TrimSpace(rawMax))
+			if err != nil || maxPages < 0 {
+				return nil, i18n.Errorf("invalid page limit in thickness bucket %q", part)
+			}
+			if i > 0 && maxPages <= buckets[i-1].MaxPages {
+				return nil, i18n.Errorf("thickness bucket page limits must increase, got %q", spec)
+			}
+			bucket.MaxPages = maxPages
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets, nil
+}
+
+// ReleaseYears returns the allowed release years, both inclusive.
+func (r *Rules) ReleaseYears() (int, int) {
+	if r.MaxReleaseYear != 0 {
+		return r.MinReleaseYear, r.MaxReleaseYear
+	}
+	return r.MinReleaseYear, time.Now().Year() + r.ReleaseYearsAhead
+}
+
+func (r *Rules) ValidReleaseYear(year int) bool {
+	minYear, maxYear := r.ReleaseYears()
+	return year >= minYear && year <= maxYear
+}
+
+// Save writes the release year rules to the book_rules table, where a trigger
+// applies them to every book that is inserted or given a new release year,
+// including writes that do not go through the API. Instances sharing a
+// database must use the same rules, since the last one started wins there.
+func (r *Rules) Save(db *sql.DB) error {
+	maxYear := sql.NullInt64{Int64: int64(r.MaxReleaseYear), Valid: r.MaxReleaseYear != 0}
+	_, err := db.Exec(
+		"UPDATE book_rules SET min_release_year=$1, max_release_year=$2, release_years_ahead=$3",
+		r.MinReleaseYear, maxYear, r.ReleaseYearsAhead,
+	)
+	return err
+}
+
+// Thickness classifies a book by its page count.
+func (r *Rules) Thickness(pages int) string {
+	last := len(r.Buckets) - 1
+	for _, bucket := range r.Buckets[:last] {
+		if pages <= bucket.MaxPages {
+			return bucket.Name
+		}
+	}
+	return r.Buckets[last].Name
+}
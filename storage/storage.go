@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// Blob is an open stored object. Callers must close it.
+type Blob struct {
+	io.ReadCloser
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+}
+
+type BlobStore interface {
+	Put(key string, r io.Reader, contentType string) error
+	Get(key string) (*Blob, error)
+	Delete(key string) error
+}
+
+type Config struct {
+	Driver   string
+	LocalDir string
+}
+
+var Default BlobStore = &LocalStore{Dir: "uploads"}
+
+func New(cfg Config) (BlobStore, error) {
+	switch cfg.Driver {
+	case "", "local":
+		dir := cfg.LocalDir
+		if dir == "" {
+			dir = "uploads"
+		}
+		return &LocalStore{Dir: dir}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+	}
+}
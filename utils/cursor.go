@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type Cursor struct {
+	Scope string `json:"scope"`
+	Sort  string `json:"sort"`
+	Order string `json:"order"`
+	Value string `json:"value"`
+	ID    int    `json:"id"`
+}
+
+func EncodeCursor(cursor Cursor) (string, error) {
+	payload, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + signCursor(encoded), nil
+}
+
+func DecodeCursor(token string) (*Cursor, error) {
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	if !hmac.Equal([]byte(signature), []byte(signCursor(encoded))) {
+		return nil, fmt.Errorf("invalid cursor signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(payload, &cursor); err != nil {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	return &cursor, nil
+}
+
+func signCursor(encoded string) string {
+	mac := hmac.New(sha256.New, append([]byte("cursor:"), jwtKey...))
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/kandlagifari/go-books-apps/i18n"
+)
+
+var ErrInvalidISBN = i18n.Errorf("Invalid ISBN")
+
+// NormalizeISBN accepts an ISBN-10 or ISBN-13, with or without hyphens and
+// spaces, validates its check digit and returns both forms. ISBN-13s in the
+// 979 range have no ISBN-10 equivalent, so isbn10 is empty for them.
+func NormalizeISBN(raw string) (isbn10, isbn13 string, err error) {
+	digits := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(raw)))
+
+	switch len(digits) {
+	case 10:
+		if !validISBN10(digits) {
+			return "", "", ErrInvalidISBN
+		}
+		return digits, ISBN10To13(digits), nil
+	case 13:
+		if !validISBN13(digits) {
+			return "", "", ErrInvalidISBN
+		}
+		return ISBN13To10(digits), digits, nil
+	default:
+		return "", "", ErrInvalidISBN
+	}
+}
+
+func validISBN10(isbn string) bool {
+	sum := 0
+	for i := 0; i < 10; i++ {
+		var value int
+		switch {
+		case isbn[i] >= '0' && isbn[i] <= '9':
+			value = int(isbn[i] - '0')
+		case isbn[i] == 'X' && i == 9:
+			value = 10
+		default:
+			return false
+		}
+		sum += value * (10 - i)
+	}
+	return sum%11 == 0
+}
+
+func validISBN13(isbn string) bool {
+	for i := 0; i < 13; i++ {
+		if isbn[i] < '0' || isbn[i] > '9' {
+			return false
+		}
+	}
+	return isbn13CheckDigit(isbn[:12]) == isbn[12]
+}
+
+func isbn13CheckDigit(first12 string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += int(first12[i]-'0') * weight
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func isbn10CheckDigit(first9 string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(first9[i]-'0') * (10 - i)
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+// ISBN10To13 converts a valid ISBN-10 into its 978-prefixed ISBN-13.
+func ISBN10To13(isbn10 string) string {
+	first12 := "978" + isbn10[:9]
+	return first12 + string(isbn13CheckDigit(first12))
+}
+
+// ISBN13To10 converts a valid ISBN-13 back to ISBN-10, or returns "" when it
+// is outside the 978 range.
+func ISBN13To10(isbn13 string) string {
+	if !strings.HasPrefix(isbn13, "978") {
+		return ""
+	}
+	first9 := isbn13[3:12]
+	return first9 + string(isbn10CheckDigit(first9))
+}
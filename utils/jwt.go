@@ -1,25 +1,51 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
-var jwtKey = []byte(os.Getenv("JWT_SECRET_KEY"))
+// jwtKey signs access tokens and cursors. It is set once at startup, after
+// the configuration is loaded.
+var jwtKey []byte
+
+func SetJWTKey(key string) {
+	jwtKey = []byte(key)
+}
+
+var (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
 
 type Claims struct {
 	Username string `json:"username"`
+	Role     string `json:"role"`
+	Family   string `json:"fid"`
 	jwt.StandardClaims
 }
 
-func GenerateToken(username string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+// GenerateToken issues a short-lived access token. The family ties it to the
+// refresh token chain it was issued with, so revoking the family also cuts
+// off access tokens that are still within their lifetime.
+func GenerateToken(username, role, family string) (string, error) {
+	jti, err := RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	expirationTime := time.Now().Add(AccessTokenTTL)
 	claims := &Claims{
 		Username: username,
+		Role:     role,
+		Family:   family,
 		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
 			ExpiresAt: expirationTime.Unix(),
 		},
 	}
@@ -46,3 +72,18 @@ func ValidateToken(tokenStr string) (*Claims, error) {
 	}
 	return claims, nil
 }
+
+func RandomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// HashToken is used for opaque tokens stored server-side; only the hash is
+// persisted so a database leak does not hand out usable tokens.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/kandlagifari/go-books-apps/i18n"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+type Pagination struct {
+	Page       int     `json:"page"`
+	PageSize   int     `json:"page_size"`
+	Total      int     `json:"total"`
+	TotalPages int     `json:"total_pages"`
+	Next       *string `json:"next"`
+	Prev       *string `json:"prev"`
+
+	offset     int
+	useOffsets bool
+}
+
+// ParsePagination reads either page/page_size or limit/offset from the query
+// string. The two styles cannot be mixed in a single request.
+func ParsePagination(query url.Values) (*Pagination, error) {
+	p := &Pagination{Page: 1, PageSize: DefaultPageSize}
+
+	hasPage := query.Has("page") || query.Has("page_size")
+	hasOffset := query.Has("limit") || query.Has("offset")
+	if hasPage && hasOffset {
+		return nil, i18n.Errorf("page/page_size cannot be combined with limit/offset")
+	}
+
+	sizeKey := "page_size"
+	if hasOffset {
+		sizeKey = "limit"
+		p.useOffsets = true
+	}
+
+	if raw := query.Get(sizeKey); raw != "" {
+		size, err := strconv.Atoi(raw)
+		if err != nil || size < 1 {
+			return nil, i18n.Errorf("%s must be a positive integer", sizeKey)
+		}
+		if size > MaxPageSize {
+			size = MaxPageSize
+		}
+		p.PageSize = size
+	}
+
+	if p.useOffsets {
+		if raw := query.Get("offset"); raw != "" {
+			offset, err := strconv.Atoi(raw)
+			if err != nil || offset < 0 {
+				return nil, i18n.Errorf("offset must be a non-negative integer")
+			}
+			p.offset = offset
+		}
+		p.Page = p.offset/p.PageSize + 1
+		return p, nil
+	}
+
+	if raw := query.Get("page"); raw != "" {
+		page, err := strconv.Atoi(raw)
+		if err != nil || page < 1 {
+			return nil, i18n.Errorf("page must be a positive integer")
+		}
+		p.Page = page
+	}
+	p.offset = (p.Page - 1) * p.PageSize
+
+	return p, nil
+}
+
+func (p *Pagination) Limit() int {
+	return p.PageSize
+}
+
+func (p *Pagination) Offset() int {
+	return p.offset
+}
+
+// SetTotal records the total row count and builds the next/prev links from
+// the request URL, preserving every other query parameter.
+func (p *Pagination) SetTotal(total int, requestURL *url.URL) {
+	p.Total = total
+	p.TotalPages = (total + p.PageSize - 1) / p.PageSize
+
+	if p.offset+p.PageSize < total {
+		p.Next = p.link(requestURL, p.offset+p.PageSize)
+	}
+	if p.offset > 0 {
+		prev := p.offset - p.PageSize
+		if prev < 0 {
+			prev = 0
+		}
+		p.Prev = p.link(requestURL, prev)
+	}
+}
+
+func (p *Pagination) link(requestURL *url.URL, offset int) *string {
+	query := requestURL.Query()
+	if p.useOffsets {
+		query.Set("limit", strconv.Itoa(p.PageSize))
+		query.Set("offset", strconv.Itoa(offset))
+	} else {
+		query.Set("page", strconv.Itoa(offset/p.PageSize+1))
+		query.Set("page_size", strconv.Itoa(p.PageSize))
+	}
+
+	link := requestURL.Path + "?" + query.Encode()
+	return &link
+}
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+const MaxSlugLength = 64
+
+// Slugify case-folds s and collapses every run of characters other than
+// letters and digits into a single hyphen, so "Award Winner", "award_winner"
+// and " AWARD-winner " all become "award-winner".
+func Slugify(s string) string {
+	var b strings.Builder
+	pendingHyphen := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if pendingHyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			pendingHyphen = false
+			b.WriteRune(r)
+			continue
+		}
+		pendingHyphen = true
+	}
+	return b.String()
+}